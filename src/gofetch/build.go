@@ -0,0 +1,394 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+
+package main
+
+import (
+  "os"
+  "io"
+  "fmt"
+  "path"
+  "sync"
+  "bufio"
+  "bytes"
+  "strings"
+  "os/exec"
+  "io/ioutil"
+  "go/build"
+  "go/token"
+  "go/parser"
+  "go/build/constraint"
+)
+
+const allBuildValues = "all"
+
+/**
+ * An operating system and architecture combination
+ */
+type platform struct {
+  OS, Arch string
+}
+
+var (
+  platformsOnce sync.Once
+  platforms     []platform
+)
+
+/**
+ * Obtain the platforms supported by the Go toolchain. If the toolchain can't be
+ * asked, nil is returned.
+ */
+func supportedPlatforms() []platform {
+  platformsOnce.Do(func() {
+    out, err := exec.Command("go", "tool", "dist", "list").Output()
+    if err != nil {
+      return
+    }
+    for _, e := range strings.Split(string(out), "\n") {
+      if f := strings.Split(strings.TrimSpace(e), "/"); len(f) == 2 {
+        platforms = append(platforms, platform{f[0], f[1]})
+      }
+    }
+  })
+  return platforms
+}
+
+/**
+ * Determine if a value is an operating system or architecture known to the Go
+ * toolchain. If the toolchain can't be asked, anything is.
+ */
+func knownPlatformValue(v string, arch bool) bool {
+  l := supportedPlatforms()
+  if l == nil {
+    return true
+  }
+  for _, e := range l {
+    if (!arch && e.OS == v) || (arch && e.Arch == v) {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * A build context describes the operating systems, architectures and build tags
+ * for which sources are considered. A nil list means any value is acceptable.
+ */
+type buildContext struct {
+  OS, Arch, Tags []string
+}
+
+/**
+ * Parse a build context from comma-separated lists of operating systems,
+ * architectures and build tags, any of which may be 'all'
+ */
+func parseBuildContext(goos, goarch, tags string) (*buildContext, error) {
+  c := &buildContext{}
+  var err error
+  
+  c.OS, err = parseBuildList(goos, func(v string) bool { return knownPlatformValue(v, false) })
+  if err != nil {
+    return nil, fmt.Errorf("invalid operating system: %v", err)
+  }
+  c.Arch, err = parseBuildList(goarch, func(v string) bool { return knownPlatformValue(v, true) })
+  if err != nil {
+    return nil, fmt.Errorf("invalid architecture: %v", err)
+  }
+  c.Tags, err = parseBuildList(tags, nil)
+  if err != nil {
+    return nil, fmt.Errorf("invalid build tags: %v", err)
+  }
+  
+  return c, nil
+}
+
+/**
+ * Parse a comma-separated list, validating its values if a function is provided
+ */
+func parseBuildList(s string, valid func(string) bool) ([]string, error) {
+  if s == allBuildValues {
+    return nil, nil
+  }
+  l := make([]string, 0)
+  for _, e := range strings.Split(s, ",") {
+    if e = strings.TrimSpace(e); e == "" {
+      continue
+    }
+    if valid != nil && !valid(e) {
+      return nil, fmt.Errorf("%v", e)
+    }
+    l = append(l, e)
+  }
+  return l, nil
+}
+
+/**
+ * Determine if this context accepts every source file, in which case there is
+ * no need to evaluate constraints at all
+ */
+func (c *buildContext) All() bool {
+  return c == nil || (c.OS == nil && c.Arch == nil && c.Tags == nil)
+}
+
+/**
+ * Determine the platforms this context considers. If it accepts any operating
+ * system or architecture and the toolchain can't tell us what they are, nil is
+ * returned.
+ */
+func (c *buildContext) Platforms() []platform {
+  var l []platform
+  if c.OS != nil && c.Arch != nil {
+    for _, goos := range c.OS {
+      for _, goarch := range c.Arch {
+        l = append(l, platform{goos, goarch})
+      }
+    }
+    return l
+  }
+  for _, e := range supportedPlatforms() {
+    if (c.OS == nil || containsString(c.OS, e.OS)) && (c.Arch == nil || containsString(c.Arch, e.Arch)) {
+      l = append(l, e)
+    }
+  }
+  return l
+}
+
+/**
+ * Determine if a Go source file would be built for any of the platforms in this
+ * context. Its name (e.g., '_windows_amd64.go') is matched by the go/build
+ * package and the build constraints in its header are evaluated for each
+ * platform. When any build tags are acceptable, tags other than those implied
+ * by the platform may take any value. A file which can't be read or whose
+ * constraints can't be parsed is reported and accepted; it's not for us to
+ * decide.
+ */
+func (c *buildContext) MatchFile(p string) bool {
+  if c.All() {
+    return true
+  }
+  
+  data, err := ioutil.ReadFile(p)
+  if err != nil {
+    warnBuildConstraint(p, err)
+    return true
+  }
+  
+  x, err := parseBuildConstraint(data)
+  if err != nil {
+    warnBuildConstraint(p, err)
+    return true
+  }
+  
+  // a cgo file can only be built if cgo may be enabled
+  if c.Tags != nil && !containsString(c.Tags, "cgo") && importsCgo(p, data) {
+    return false
+  }
+  
+  l := c.Platforms()
+  if l == nil {
+    return true // we can't tell which platforms there are, so we can't rule any out
+  }
+  
+  for _, e := range l {
+    if !matchFileName(p, e) {
+      continue
+    }
+    if x == nil {
+      return true
+    }
+    if sat, _ := c.evalConstraint(x, e); sat {
+      return true
+    }
+  }
+  
+  return false
+}
+
+/**
+ * Determine if the name of a file (e.g., '_windows_amd64.go') allows it to be
+ * built on a platform
+ */
+func matchFileName(p string, e platform) bool {
+  ctx := build.Default
+  ctx.GOOS, ctx.GOARCH = e.OS, e.Arch
+  ctx.OpenFile = func(string) (io.ReadCloser, error) {
+    return ioutil.NopCloser(strings.NewReader("package x\n")), nil // the name, not the content, is matched
+  }
+  ok, err := ctx.MatchFile(path.Dir(p), path.Base(p))
+  return ok && err == nil
+}
+
+/**
+ * Determine if a Go source file imports "C"
+ */
+func importsCgo(p string, data []byte) bool {
+  f, err := parser.ParseFile(token.NewFileSet(), p, data, parser.ImportsOnly)
+  if err != nil {
+    return false // not for us to report
+  }
+  for _, e := range f.Imports {
+    if e.Path.Value == `"C"` {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Report a file whose build constraints could not be evaluated
+ */
+func warnBuildConstraint(p string, err error) {
+  fmt.Fprintf(os.Stderr, "%v: ignoring build constraints for %v: %v\n", cmd, p, err)
+}
+
+/**
+ * Parse the build constraints in the header of a Go source file, which precede
+ * its package clause. A '//go:build' line takes precedence over '// +build'
+ * lines, which are otherwise combined. If there are none, nil is returned.
+ */
+func parseBuildConstraint(data []byte) (constraint.Expr, error) {
+  var plus constraint.Expr
+  
+  scanner := bufio.NewScanner(bytes.NewReader(data))
+  for scanner.Scan() {
+    line := strings.TrimSpace(scanner.Text())
+    if strings.HasPrefix(line, "package ") {
+      break
+    }
+    if constraint.IsGoBuild(line) {
+      x, err := constraint.Parse(line)
+      if err != nil {
+        return nil, fmt.Errorf("parsing //go:build line: %v", err)
+      }
+      return x, nil
+    }
+    if constraint.IsPlusBuild(line) {
+      x, err := constraint.Parse(line)
+      if err != nil {
+        return nil, fmt.Errorf("parsing // +build line: %v", err)
+      }
+      if plus == nil {
+        plus = x
+      }else{
+        plus = &constraint.AndExpr{X: plus, Y: x}
+      }
+    }
+  }
+  
+  return plus, nil
+}
+
+/**
+ * Operating systems which satisfy the 'unix' build tag
+ */
+var unixOS = map[string]bool{
+  "aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+  "hurd": true, "illumos": true, "ios": true, "linux": true, "netbsd": true,
+  "openbsd": true, "solaris": true,
+}
+
+/**
+ * Operating systems which also satisfy the build tag of another
+ */
+var impliedOS = map[string]string{
+  "android": "linux",
+  "illumos": "solaris",
+  "ios": "darwin",
+}
+
+/**
+ * Evaluate a build constraint on a platform, producing whether it can be
+ * satisfied and whether it can be unsatisfied. Tags implied by the platform or
+ * toolchain have a fixed value, as do the others if build tags are provided;
+ * otherwise they are free to take either value. Each appearance of a free tag
+ * is considered independently, so a contradiction like 'foo && !foo' is
+ * considered satisfiable, but the cost is linear in the size of the constraint.
+ */
+func (c *buildContext) evalConstraint(x constraint.Expr, e platform) (bool, bool) {
+  switch v := x.(type) {
+    case *constraint.NotExpr:
+      t, f := c.evalConstraint(v.X, e)
+      return f, t
+    case *constraint.AndExpr:
+      at, af := c.evalConstraint(v.X, e)
+      bt, bf := c.evalConstraint(v.Y, e)
+      return at && bt, af || bf
+    case *constraint.OrExpr:
+      at, af := c.evalConstraint(v.X, e)
+      bt, bf := c.evalConstraint(v.Y, e)
+      return at || bt, af && bf
+    case *constraint.TagExpr:
+      if val, fixed := c.buildTagValue(v.Tag, e); fixed {
+        return val, !val
+      }
+      return true, true
+  }
+  return true, true
+}
+
+/**
+ * Determine the value of a build tag on a platform, if it has a fixed one
+ */
+func (c *buildContext) buildTagValue(tag string, e platform) (bool, bool) {
+  switch {
+    case tag == e.OS || tag == e.Arch || tag == impliedOS[e.OS]:
+      return true, true
+    case tag == "unix":
+      return unixOS[e.OS], true
+    case tag == "gc" || tag == "gccgo":
+      return tag == build.Default.Compiler, true
+    case strings.HasPrefix(tag, "go1."):
+      return containsString(build.Default.ReleaseTags, tag), true
+    case impliedBuildTag(tag):
+      return false, true // another platform
+    case c.Tags != nil:
+      return containsString(c.Tags, tag), true
+  }
+  return false, false
+}
+
+/**
+ * Determine if a build tag is implied by the platform or toolchain
+ */
+func impliedBuildTag(tag string) bool {
+  switch {
+    case tag == "unix" || tag == "gc" || tag == "gccgo":
+      return true
+    case strings.HasPrefix(tag, "go1."):
+      return true
+  }
+  for _, e := range supportedPlatforms() {
+    if tag == e.OS || tag == e.Arch {
+      return true
+    }
+  }
+  return false
+}
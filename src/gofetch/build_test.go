@@ -0,0 +1,132 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "os"
+  "path"
+  "strings"
+  "testing"
+  "io/ioutil"
+)
+
+var manyTags = []string{"t1", "t2", "t3", "t4", "t5", "t6", "t7", "t8", "t9", "t10", "t11", "t12", "t13", "t14", "t15", "t16", "t17", "t18", "t19", "t20"}
+
+/**
+ * Test matching source files against build contexts
+ */
+func TestBuildContextMatchFile(t *testing.T) {
+  
+  dir, err := ioutil.TempDir("", "gofetch-test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  
+  files := map[string]string{
+    "plain.go":             "package x\n",
+    "file_windows.go":      "package x\n",
+    "file_linux_arm64.go":  "package x\n",
+    "unix.go":              "//go:build unix\n\npackage x\n",
+    "darwin.go":            "// +build darwin\n\npackage x\n",
+    "custom.go":            "//go:build linux && custom\n\npackage x\n",
+    "notcustom.go":         "//go:build !custom\n\npackage x\n",
+    "cgo.go":               "//go:build cgo\n\npackage x\n",
+    "never.go":             "//go:build linux && !linux\n\npackage x\n",
+    "malformed.go":         "//go:build linux &&\n\npackage x\n",
+    "cgoimport.go":         "package x\n\nimport \"C\"\n",
+    "freenever.go":         "//go:build custom && !custom\n\npackage x\n",
+    "plustags.go":          "// +build linux darwin\n// +build !custom\n\npackage x\n",
+    "manytags.go":          "//go:build plan9 && ("+strings.Join(manyTags, " || ")+")\n\npackage x\n",
+  }
+  for k, v := range files {
+    err := ioutil.WriteFile(path.Join(dir, k), []byte(v), 0644)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  
+  tests := []struct {
+    OS, Arch, Tags  string
+    Match           []string
+    NoMatch         []string
+  }{
+    {"all", "all", "all", []string{"plain.go", "file_windows.go", "file_linux_arm64.go", "unix.go", "darwin.go", "custom.go", "notcustom.go", "cgo.go", "never.go", "malformed.go"}, nil}, // nothing is evaluated
+    {"linux", "all", "all", []string{"plain.go", "file_linux_arm64.go", "unix.go", "custom.go", "notcustom.go", "cgo.go"}, []string{"file_windows.go", "darwin.go", "never.go"}},
+    {"linux", "amd64", "all", []string{"plain.go", "unix.go", "custom.go"}, []string{"file_linux_arm64.go", "file_windows.go"}},
+    {"windows", "all", "all", []string{"plain.go", "file_windows.go"}, []string{"unix.go", "darwin.go", "custom.go", "file_linux_arm64.go"}},
+    {"android", "all", "all", []string{"file_linux_arm64.go", "unix.go", "custom.go"}, []string{"darwin.go"}},
+    {"linux", "all", "", []string{"plain.go", "notcustom.go"}, []string{"custom.go", "cgo.go"}},
+    {"linux", "all", "custom,cgo", []string{"custom.go", "cgo.go"}, []string{"notcustom.go"}},
+    {"linux", "all", "", []string{"malformed.go"}, nil}, // reported and accepted
+    {"linux", "all", "all", []string{"cgoimport.go", "plustags.go"}, []string{"manytags.go"}},
+    {"linux", "all", "", []string{"plustags.go"}, []string{"cgoimport.go"}},
+    {"linux", "all", "custom", nil, []string{"plustags.go", "freenever.go"}},
+    {"linux", "all", "all", []string{"freenever.go"}, nil}, // free tags are considered independently
+    {"plan9", "all", "all", []string{"manytags.go"}, []string{"plustags.go"}},
+    {"plan9", "all", "t3", []string{"manytags.go"}, nil},
+    {"plan9", "all", "", nil, []string{"manytags.go"}},
+  }
+  
+  for _, e := range tests {
+    c, err := parseBuildContext(e.OS, e.Arch, e.Tags)
+    if err != nil {
+      t.Errorf("parseBuildContext(%q, %q, %q): %v", e.OS, e.Arch, e.Tags, err)
+      continue
+    }
+    for _, f := range e.Match {
+      if !c.MatchFile(path.Join(dir, f)) {
+        t.Errorf("-os %v -arch %v -tags %q: expected %v to match", e.OS, e.Arch, e.Tags, f)
+      }
+    }
+    for _, f := range e.NoMatch {
+      if c.MatchFile(path.Join(dir, f)) {
+        t.Errorf("-os %v -arch %v -tags %q: expected %v not to match", e.OS, e.Arch, e.Tags, f)
+      }
+    }
+  }
+  
+}
+
+/**
+ * Test that unknown operating systems and architectures are rejected
+ */
+func TestParseBuildContextInvalid(t *testing.T) {
+  if supportedPlatforms() == nil {
+    t.Skip("the Go toolchain is not available")
+  }
+  if _, err := parseBuildContext("linux,plan10", "all", "all"); err == nil {
+    t.Errorf("expected an invalid operating system to be rejected")
+  }
+  if _, err := parseBuildContext("all", "amd65", "all"); err == nil {
+    t.Errorf("expected an invalid architecture to be rejected")
+  }
+}
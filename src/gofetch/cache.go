@@ -0,0 +1,252 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+
+package main
+
+import (
+  "os"
+  "fmt"
+  "path"
+  "sync"
+  "net/url"
+  "time"
+  "strings"
+  "io/ioutil"
+  "encoding/json"
+)
+
+var errOffline = fmt.Errorf("network access is not permitted in offline mode")
+
+/**
+ * An error indicating that a package could not be fetched in offline mode
+ */
+type offlineError struct {
+  Package string
+  Reason  string
+}
+
+/**
+ * Describe
+ */
+func (e *offlineError) Error() string {
+  return fmt.Sprintf("%v: %v", e.Package, e.Reason)
+}
+
+/**
+ * Determine the default directory in which to cache repository mirrors. This
+ * is $XDG_CACHE_HOME/gofetch or, if that is not set, ~/.cache/gofetch.
+ */
+func defaultCacheDir() string {
+  if d := os.Getenv("XDG_CACHE_HOME"); d != "" {
+    return path.Join(d, "gofetch")
+  }
+  if d := os.Getenv("HOME"); d != "" {
+    return path.Join(d, ".cache", "gofetch")
+  }
+  return ""
+}
+
+/**
+ * Determine the path of the mirror of a repository in the cache. Mirrors are
+ * organized by VCS and then by the host and path of the repository URL.
+ */
+func mirrorPath(base string, vcs *vcsCmd, repo string) string {
+  var rel string
+  if u, err := url.Parse(repo); err == nil && u.Host != "" {
+    rel = path.Join(u.Host, u.Path)
+  }else{
+    rel = strings.NewReplacer(":", "/", "@", "/").Replace(repo)
+  }
+  return path.Join(base, "mirrors", vcs.cmd, path.Clean("/"+rel))
+}
+
+const defaultDiscoveryTTL = time.Hour * 24
+
+/**
+ * A discovered repository
+ */
+type discoveryEntry struct {
+  VCS   string    `json:"vcs"`
+  Repo  string    `json:"repo"`
+  Time  time.Time `json:"time"`
+}
+
+/**
+ * Discovered go-import meta tags
+ */
+type discoveryImports struct {
+  URL     string        `json:"url"`
+  Imports []metaImport  `json:"imports"`
+  Time    time.Time     `json:"time"`
+}
+
+/**
+ * The discovery cache records the repositories that import paths have been
+ * resolved to, keyed by their root import path, and the go-import meta tags
+ * found for import prefixes, so that they can be resolved again without access
+ * to the network. It is safe for concurrent use.
+ */
+type discoveryCache struct {
+  sync.Mutex
+  Roots   map[string]discoveryEntry   `json:"roots"`
+  Imports map[string]discoveryImports `json:"imports"`
+  dirty   bool
+}
+
+var discovery = &discoveryCache{
+  Roots: make(map[string]discoveryEntry),
+  Imports: make(map[string]discoveryImports),
+}
+
+/**
+ * Determine if something discovered at the provided time may still be used.
+ * In offline mode everything may be used, since we have no alternative.
+ */
+func discoveryFresh(t time.Time) bool {
+  return optOffline || (!optRefreshDiscovery && time.Since(t) < optDiscoveryTTL)
+}
+
+/**
+ * Determine the path of the discovery cache
+ */
+func discoveryCachePath() string {
+  return path.Join(optCacheDir, "discovery.json")
+}
+
+/**
+ * Load the discovery cache, if the cache is enabled and it exists
+ */
+func loadDiscoveryCache() error {
+  if optCacheDir == "" {
+    return nil
+  }
+  
+  data, err := ioutil.ReadFile(discoveryCachePath())
+  if os.IsNotExist(err) {
+    return nil
+  }else if err != nil {
+    return fmt.Errorf("could not read discovery cache: %v", err)
+  }
+  
+  discovery.Lock()
+  defer discovery.Unlock()
+  err = json.Unmarshal(data, discovery)
+  if err != nil {
+    return fmt.Errorf("could not parse discovery cache: %v", err)
+  }
+  if discovery.Roots == nil {
+    discovery.Roots = make(map[string]discoveryEntry)
+  }
+  if discovery.Imports == nil {
+    discovery.Imports = make(map[string]discoveryImports)
+  }
+  
+  return nil
+}
+
+/**
+ * Save the discovery cache, if the cache is enabled and it has changed
+ */
+func saveDiscoveryCache() error {
+  discovery.Lock()
+  defer discovery.Unlock()
+  if optCacheDir == "" || !discovery.dirty {
+    return nil
+  }
+  
+  data, err := json.MarshalIndent(discovery, "", "  ")
+  if err != nil {
+    return err
+  }
+  
+  err = os.MkdirAll(optCacheDir, os.ModeDir | 0755)
+  if err != nil {
+    return fmt.Errorf("could not create cache directory: %v", err)
+  }
+  
+  err = ioutil.WriteFile(discoveryCachePath(), append(data, '\n'), 0644)
+  if err != nil {
+    return fmt.Errorf("could not write discovery cache: %v", err)
+  }
+  
+  discovery.dirty = false
+  return nil
+}
+
+/**
+ * Record a resolved repository
+ */
+func (d *discoveryCache) Add(repo *repoRoot) {
+  d.Lock()
+  defer d.Unlock()
+  d.Roots[repo.root] = discoveryEntry{VCS: repo.vcs.cmd, Repo: repo.repo, Time: time.Now()}
+  d.dirty = true
+}
+
+/**
+ * Find the discovered repository which contains the provided package, if any.
+ * The most specific root is preferred. Expired entries are ignored.
+ */
+func (d *discoveryCache) RepoRoot(pkg string) (*repoRoot, bool) {
+  d.Lock()
+  defer d.Unlock()
+  for p := pkg; p != "." && p != "/"; p = path.Dir(p) {
+    if e, ok := d.Roots[p]; ok && discoveryFresh(e.Time) {
+      if vcs := vcsByCmd(e.VCS); vcs != nil {
+        return &repoRoot{vcs: vcs, repo: e.Repo, root: p}, true
+      }
+    }
+  }
+  return nil, false
+}
+
+/**
+ * Record the go-import meta tags discovered for an import prefix
+ */
+func (d *discoveryCache) AddImports(prefix, urlStr string, imports []metaImport) {
+  d.Lock()
+  defer d.Unlock()
+  d.Imports[prefix] = discoveryImports{URL: urlStr, Imports: imports, Time: time.Now()}
+  d.dirty = true
+}
+
+/**
+ * Find the go-import meta tags discovered for an import prefix, if any. Expired
+ * entries are ignored.
+ */
+func (d *discoveryCache) LookupImports(prefix string) (string, []metaImport, bool) {
+  d.Lock()
+  defer d.Unlock()
+  if e, ok := d.Imports[prefix]; ok && discoveryFresh(e.Time) {
+    return e.URL, e.Imports, true
+  }
+  return "", nil, false
+}
@@ -0,0 +1,68 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+
+// +build aix darwin dragonfly freebsd linux netbsd openbsd
+
+package main
+
+import (
+  "os"
+  "syscall"
+)
+
+/**
+ * Acquire an exclusive lock on a path in the cache, which may be shared by
+ * several processes, by locking a file beside it. The lock is held until the
+ * returned function is called or the process exits.
+ */
+func lockCachePath(p string) (func(), error) {
+  
+  file, err := os.OpenFile(p+".lock", os.O_RDWR | os.O_CREATE, 0644)
+  if err != nil {
+    return nil, err
+  }
+  
+  for {
+    err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+    if err != syscall.EINTR {
+      break
+    }
+  }
+  if err != nil {
+    file.Close()
+    return nil, err
+  }
+  
+  return func() {
+    syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+    file.Close()
+  }, nil
+}
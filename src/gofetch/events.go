@@ -0,0 +1,208 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "os"
+  "fmt"
+  "sync"
+  "strings"
+  "encoding/json"
+)
+
+const (
+  actionCreated = "created"
+  actionUpdated = "updated"
+  actionSkipped = "skipped"
+  actionRemoved = "removed"
+  actionScanned = "scanned"
+  actionFailed  = "failed"
+)
+
+/**
+ * An event describes something that happened to a package. With -json events
+ * are written as one JSON object per line, otherwise as text.
+ */
+type event struct {
+  Action    string    `json:"action"`
+  Package   string    `json:"package,omitempty"`
+  Root      string    `json:"root,omitempty"`
+  VCS       string    `json:"vcs,omitempty"`
+  Repo      string    `json:"repo,omitempty"`
+  Output    string    `json:"output,omitempty"`
+  Version   string    `json:"version,omitempty"`
+  Revision  string    `json:"revision,omitempty"`
+  Imports   []string  `json:"imports,omitempty"`
+  Reason    string    `json:"reason,omitempty"`
+  Error     string    `json:"error,omitempty"`
+  DryRun    bool      `json:"dryRun,omitempty"` // the action would have been taken, but wasn't
+}
+
+/**
+ * Create an event for a package in a repository
+ */
+func newRepoEvent(action, pkg, dir string, repo *repoRoot) *event {
+  ev := &event{Action: action, Package: pkg, Output: dir}
+  if repo != nil {
+    ev.Root, ev.Repo = repo.root, repo.repo
+    if repo.vcs != nil {
+      ev.VCS = repo.vcs.cmd
+    }
+  }
+  return ev
+}
+
+/**
+ * Describe an event as text, the way it's reported without -json
+ */
+func (e *event) String() string {
+  desc := e.Package
+  if e.Version != "" {
+    desc += "@"+e.Version
+  }
+  
+  if e.DryRun {
+    return e.plan(desc)
+  }
+  
+  switch e.Action {
+    case actionRemoved:
+      return fmt.Sprintf(" - %v (%v)", desc, e.Reason)
+    case actionFailed:
+      return fmt.Sprintf(" ! %v: %v", desc, e.Error)
+  }
+  
+  if e.Root != "" && e.Root != e.Package {
+    return fmt.Sprintf(" + %v (%v)", desc, e.Root)
+  }else{
+    return fmt.Sprintf(" + %v", desc)
+  }
+}
+
+/**
+ * Describe an event in a dry run as a step in a plan
+ */
+func (e *event) plan(desc string) string {
+  verb, ok := planVerbs[e.Action]
+  if !ok {
+    verb = e.Action
+  }
+  
+  s := fmt.Sprintf(" %-6v %v", verb, desc)
+  if e.Root != "" && e.Root != e.Package {
+    s += fmt.Sprintf(" (%v)", e.Root)
+  }
+  if e.Revision != "" {
+    s += " at "+shortRevision(e.Revision)
+  }
+  if e.Reason != "" {
+    s += fmt.Sprintf(" (%v)", e.Reason)
+  }
+  
+  return s
+}
+
+var planVerbs = map[string]string{
+  actionCreated: "create",
+  actionUpdated: "update",
+  actionSkipped: "keep",
+  actionRemoved: "remove",
+}
+
+/**
+ * Abbreviate a revision for display
+ */
+func shortRevision(rev string) string {
+  if len(rev) > 12 {
+    return rev[:12]
+  }
+  return rev
+}
+
+var eventMu sync.Mutex
+
+/**
+ * Report an event, either as JSON or as text
+ */
+func emit(e *event) {
+  if optJSON {
+    if err := writeJSON(e); err != nil {
+      fmt.Fprintf(os.Stderr, "%v: could not report event: %v\n", cmd, err)
+    }
+  }else{
+    eventMu.Lock()
+    fmt.Println(e.String())
+    eventMu.Unlock()
+  }
+}
+
+/**
+ * Write a value as a JSON object on a line of its own
+ */
+func writeJSON(v interface{}) error {
+  data, err := json.Marshal(v)
+  if err != nil {
+    return err
+  }
+  eventMu.Lock()
+  defer eventMu.Unlock()
+  _, err = os.Stdout.Write(append(data, '\n'))
+  return err
+}
+
+/**
+ * Report an informational message as text. With -json stdout is reserved for
+ * JSON, so messages are written to stderr instead.
+ */
+func notice(format string, args ...interface{}) {
+  w := os.Stdout
+  if optJSON {
+    w = os.Stderr
+  }
+  eventMu.Lock()
+  fmt.Fprintf(w, format+"\n", args...)
+  eventMu.Unlock()
+}
+
+/**
+ * Report an error for the current command, either as JSON or as text. When some
+ * packages could not be fetched they are summarized in a table.
+ */
+func reportError(err error) {
+  if failures, ok := err.(fetchFailures); ok && !optJSON {
+    fmt.Printf("%v: %v:\n", cmd, err)
+    failures.WriteTable(os.Stdout)
+  }else if optJSON {
+    emit(&event{Action: "error", Error: strings.TrimSpace(err.Error())})
+  }else{
+    fmt.Printf("%v: %v\n", cmd, err)
+  }
+}
@@ -0,0 +1,150 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "fmt"
+)
+
+/**
+ * Process exit codes. Usage errors share the code used by the flag package.
+ */
+const (
+  exitOK          = 0
+  exitFailure     = 1 // anything not described by a more specific code
+  exitUsage       = 2 // invalid commands, flags or arguments
+  exitResolution  = 3 // an import path could not be resolved to a repository
+  exitVCS         = 4 // a repository could not be fetched or checked out
+  exitParse       = 5 // sources or a lockfile could not be parsed
+  exitChecksum    = 6 // a repository did not match the checksum recorded for its revision
+)
+
+/**
+ * An error which determines the code the process exits with
+ */
+type exitError struct {
+  Code  int
+  Err   error
+}
+
+/**
+ * Describe
+ */
+func (e *exitError) Error() string {
+  return e.Err.Error()
+}
+
+/**
+ * Classify an error with an exit code. Errors which are already classified
+ * (or which are handled specially, like offline errors) are left as-is, so the
+ * most specific classification is the one closest to where the error occurred.
+ */
+func classify(code int, err error) error {
+  switch err.(type) {
+    case nil:
+      return nil
+    case *exitError, *offlineError, fetchFailures:
+      return err
+  }
+  return &exitError{code, err}
+}
+
+/**
+ * Classify an error as a usage error
+ */
+func usageError(err error) error {
+  return classify(exitUsage, err)
+}
+
+/**
+ * Classify an error as a resolution failure
+ */
+func resolutionError(err error) error {
+  return classify(exitResolution, err)
+}
+
+/**
+ * Classify an error as a VCS failure
+ */
+func vcsError(err error) error {
+  return classify(exitVCS, err)
+}
+
+/**
+ * Classify an error as a parse failure
+ */
+func parseError(err error) error {
+  return classify(exitParse, err)
+}
+
+/**
+ * Classify an error as a checksum mismatch
+ */
+func checksumError(err error) error {
+  return classify(exitChecksum, err)
+}
+
+/**
+ * Describe an error in more detail, retaining its classification
+ */
+func annotateError(err error, format string, args ...interface{}) error {
+  return classify(exitCode(err), fmt.Errorf("%v: %v", fmt.Sprintf(format, args...), err))
+}
+
+/**
+ * Determine the code the process should exit with for an error. When some
+ * packages could not be fetched, the code is that of their failures if they
+ * all agree.
+ */
+func exitCode(err error) int {
+  switch v := err.(type) {
+    case nil:
+      return exitOK
+    case *exitError:
+      return v.Code
+    case *offlineError:
+      return exitResolution
+    case fetchFailures:
+      code := -1
+      for _, e := range v {
+        if c := exitCode(e.Err); code < 0 || code == c {
+          code = c
+        }else{
+          return exitFailure
+        }
+      }
+      if code < 0 {
+        return exitFailure
+      }
+      return code
+  }
+  return exitFailure
+}
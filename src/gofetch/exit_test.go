@@ -0,0 +1,104 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+
+package main
+
+import (
+  "fmt"
+  "testing"
+)
+
+/**
+ * Test classifying errors
+ */
+func TestClassify(t *testing.T) {
+  base := fmt.Errorf("failed")
+  offline := &offlineError{"a/b", "not cached"}
+  
+  tests := []struct {
+    In    error
+    Code  int
+    Same  bool // the error is returned as-is
+  }{
+    {nil, exitOK, true},
+    {base, exitVCS, false},
+    {usageError(base), exitUsage, true},    // the innermost classification wins
+    {checksumError(base), exitChecksum, true},
+    {offline, exitResolution, true},
+  }
+  for i, e := range tests {
+    err := classify(exitVCS, e.In)
+    if e.Same && err != e.In {
+      t.Errorf("#%d: classify(%v) = %v; expected the error to be returned as-is", i, e.In, err)
+    }
+    if c := exitCode(err); c != e.Code {
+      t.Errorf("#%d: exitCode(classify(%v)) = %d; expected %d", i, e.In, c, e.Code)
+    }
+  }
+  
+  // failures are classified individually
+  failures := fetchFailures{{"a/b", base}}
+  if _, ok := classify(exitVCS, failures).(fetchFailures); !ok {
+    t.Errorf("classify(%v) = %v; expected the error to be returned as-is", failures, classify(exitVCS, failures))
+  }
+}
+
+/**
+ * Test determining exit codes
+ */
+func TestExitCode(t *testing.T) {
+  base := fmt.Errorf("failed")
+  
+  tests := []struct {
+    In    error
+    Code  int
+  }{
+    {nil, exitOK},
+    {base, exitFailure},
+    {usageError(base), exitUsage},
+    {resolutionError(base), exitResolution},
+    {vcsError(base), exitVCS},
+    {parseError(base), exitParse},
+    {checksumError(base), exitChecksum},
+    {&offlineError{"a/b", "not cached"}, exitResolution},
+    {annotateError(parseError(base), "could not sync"), exitParse},
+    {annotateError(base, "could not sync"), exitFailure},
+    {fetchFailures{{"a/b", vcsError(base)}, {"c/d", vcsError(base)}}, exitVCS},
+    {fetchFailures{{"a/b", vcsError(base)}, {"c/d", &offlineError{"c/d", "not cached"}}}, exitFailure},
+    {fetchFailures{{"a/b", resolutionError(base)}, {"c/d", &offlineError{"c/d", "not cached"}}}, exitResolution},
+    {fetchFailures{}, exitFailure},
+  }
+  for i, e := range tests {
+    if c := exitCode(e.In); c != e.Code {
+      t.Errorf("#%d: exitCode(%v) = %d; expected %d", i, e.In, c, e.Code)
+    }
+  }
+}
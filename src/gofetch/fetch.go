@@ -31,9 +31,13 @@
 package main
 
 import (
+  "io"
   "os"
   "fmt"
   "path"
+  "strings"
+  "net/url"
+  "text/tabwriter"
 )
 
 /**
@@ -41,13 +45,163 @@ import (
  */
 type fetchOptions struct {
   AllowUpdate, StripVCS bool
+  Locked bool
+  KeepGoing bool
+  DryRun bool
+  Jobs int
+  Strip []pathFilter
+  Versions map[string]string
   InferOptions inferOptions
 }
 
 /**
- * Fetch a package
+ * A package which could not be fetched
  */
-func fetchPackage(output string, info os.FileInfo, repo *repoRoot, opts fetchOptions) error {
+type packageFailure struct {
+  Package string
+  Err     error
+}
+
+/**
+ * Describe the reason a package could not be fetched
+ */
+func (f packageFailure) Reason() string {
+  if oerr, ok := f.Err.(*offlineError); ok {
+    return oerr.Reason
+  }
+  return strings.TrimSpace(f.Err.Error())
+}
+
+/**
+ * An error indicating that some packages could not be fetched, although the
+ * rest were
+ */
+type fetchFailures []packageFailure
+
+/**
+ * Describe
+ */
+func (f fetchFailures) Error() string {
+  return fmt.Sprintf("could not fetch %d package(s)", len(f))
+}
+
+/**
+ * Write a table summarizing the packages which could not be fetched
+ */
+func (f fetchFailures) WriteTable(w io.Writer) error {
+  t := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+  fmt.Fprintf(t, "  PACKAGE\tERROR\n")
+  for _, e := range f {
+    fmt.Fprintf(t, "  %v\t%v\n", e.Package, strings.Replace(e.Reason(), "\n", " ", -1))
+  }
+  return t.Flush()
+}
+
+/**
+ * The state of a fetch, which is shared by every worker
+ */
+type fetchState struct {
+  Repos     *claimSet   // repositories claimed for fetching, by output directory
+  Packages  *stringSet  // packages that have been visited, when following individual packages
+  Lock      *lockfile   // the lockfile, which may be nil
+  Fetched   *stringSet  // the roots of repositories which were actually fetched, rather than left alone
+  Shadow    string      // in a dry run, the directory repositories are fetched into instead of the output directory
+}
+
+/**
+ * Create fetch state
+ */
+func newFetchState(lock *lockfile) *fetchState {
+  return &fetchState{
+    Repos: newClaimSet(),
+    Packages: newStringSet(),
+    Lock: lock,
+    Fetched: newStringSet(),
+  }
+}
+
+/**
+ * Produce the filters selected by the strip options
+ */
+func stripFilters(tests, testdata, examples, nonGo bool) []pathFilter {
+  var filters []pathFilter
+  if tests {
+    filters = append(filters, testFileFilter)
+  }
+  if testdata {
+    filters = append(filters, testdataFilter)
+  }
+  if examples {
+    filters = append(filters, examplesFilter)
+  }
+  if nonGo {
+    filters = append(filters, nonGoFileFilter)
+  }
+  return filters
+}
+
+/**
+ * Determine if fetched sources are pruned in any way after they are fetched
+ */
+func (o fetchOptions) Strips() bool {
+  return o.StripVCS || len(o.Strip) > 0
+}
+
+/**
+ * Produce the filter which matches the files to prune from fetched sources,
+ * or nil if nothing is pruned. When VCS files are retained nothing inside them
+ * is ever matched.
+ */
+func (o fetchOptions) StripFilter() pathFilter {
+  if o.StripVCS {
+    return anyFilter(append([]pathFilter{vcsFileFilter}, o.Strip...)...)
+  }else if len(o.Strip) > 0 {
+    return outsideVCSFilter(anyFilter(o.Strip...))
+  }else{
+    return nil
+  }
+}
+
+/**
+ * Determine the path to a package or repository, given its path relative to the
+ * output directory. In a dry run, what has been fetched into the shadow
+ * directory takes precedence over the output directory.
+ */
+func (s *fetchState) SourcePath(outbase, rel string) string {
+  if s.Shadow != "" {
+    if p := path.Join(s.Shadow, rel); isDir(p) {
+      return p
+    }
+  }
+  return path.Join(outbase, rel)
+}
+
+/**
+ * Determine the version requested for the repository with the provided root,
+ * if any. Versions are requested for packages, which may be anywhere within
+ * the repository; if packages in the same repository are pinned to different
+ * versions we can't satisfy both.
+ */
+func (o fetchOptions) Version(root string) (string, error) {
+  var version, pkg string
+  for _, k := range sortedStringKeys(o.Versions) {
+    if k != root && !strings.HasPrefix(k, root+"/") {
+      continue
+    }
+    v := o.Versions[k]
+    if version != "" && v != version {
+      return "", usageError(fmt.Errorf("conflicting versions requested for %v: %v@%v and %v@%v", root, pkg, version, k, v))
+    }
+    version, pkg = v, k
+  }
+  return version, nil
+}
+
+/**
+ * Fetch a package. If a version is provided the repository is synced to it
+ * after being created or updated.
+ */
+func fetchPackage(output string, info os.FileInfo, repo *repoRoot, version string, opts fetchOptions) error {
   var err error
   
   if info == nil {
@@ -60,35 +214,153 @@ func fetchPackage(output string, info os.FileInfo, repo *repoRoot, opts fetchOpt
     
     err = repo.vcs.create(output, repo.repo)
     if err != nil {
-      return fmt.Errorf("could not create repo: %v\n", err)
+      return vcsError(fmt.Errorf("could not create repo: %v\n", err))
     }
     
   }else if opts.AllowUpdate {
     
     err = repo.vcs.download(output)
     if err != nil {
-      return fmt.Errorf("could not update directory: %v\n", err)
+      return vcsError(fmt.Errorf("could not update directory: %v\n", err))
     }
     
   }else{
     
     if optVerbose {
-      fmt.Printf("%v: %v exists (update to refresh)\n", cmd, repo.root)
+      notice("%v: %v exists (update to refresh)", cmd, repo.root)
     }
     
+    return nil
+  }
+  
+  // only a requested version is checked out, otherwise we leave it to the VCS
+  if version == "" {
+    return nil
+  }
+  
+  err = syncVersion(output, repo, version)
+  if err != nil {
+    return annotateError(err, "could not sync %v to version %q", repo.root, version)
   }
   
   return nil
 }
 
+/**
+ * The directory, within the output directory, in which fresh copies of
+ * repositories are staged before they are moved into place
+ */
+const stagingDir = ".gofetch-staging"
+
+/**
+ * Determine the directory in which to stage a fresh copy of a repository. Staged
+ * repositories are not nested, so they can be cleaned up independently.
+ */
+func stagingPath(outbase, root string) string {
+  return path.Join(outbase, stagingDir, url.QueryEscape(root))
+}
+
+/**
+ * Replace a directory with another, which must be on the same filesystem. If
+ * the replacement can't be moved into place the original is restored.
+ */
+func replaceDir(src, dst string) error {
+  
+  err := os.MkdirAll(path.Dir(dst), os.ModeDir | 0755)
+  if err != nil {
+    return fmt.Errorf("could not create directory: %v", err)
+  }
+  
+  // move the original aside, rather than deleting it, until we're done
+  var backup string
+  if _, err := os.Stat(dst); err == nil {
+    backup = src+".old"
+    err = os.RemoveAll(backup)
+    if err != nil {
+      return err
+    }
+    err = os.Rename(dst, backup)
+    if err != nil {
+      return fmt.Errorf("could not move %v aside: %v", dst, err)
+    }
+  }
+  
+  err = os.Rename(src, dst)
+  if err != nil {
+    if backup != "" {
+      os.Rename(backup, dst)
+    }
+    return fmt.Errorf("could not move %v into place: %v", dst, err)
+  }
+  
+  if backup != "" {
+    return os.RemoveAll(backup)
+  }
+  return nil
+}
+
+/**
+ * Sync a repository to a version, which may be a tag, a branch, a revision, or
+ * a query that selects the highest matching tag (e.g., '^1.4'). If no version
+ * is provided the repository is synced to its default.
+ */
+func syncVersion(dir string, repo *repoRoot, version string) error {
+  
+  if version == "" {
+    return vcsError(repo.vcs.tagSync(dir, ""))
+  }
+  
+  if isVersionQuery(version) {
+    q, err := parseVersionQuery(version)
+    if err != nil {
+      return usageError(err)
+    }
+    tags, err := repo.vcs.releaseTags(dir)
+    if err != nil {
+      return vcsError(fmt.Errorf("could not list tags: %v", err))
+    }
+    tag, ok := selectTag(tags, q)
+    if !ok {
+      return resolutionError(fmt.Errorf("no tag matches %v", version))
+    }
+    if optVerbose {
+      notice("%v: %v selected %v for %v", cmd, repo.root, tag, version)
+    }
+    return vcsError(repo.vcs.tagSync(dir, tag))
+  }
+  
+  tags, err := repo.vcs.tags(dir)
+  if err != nil {
+    return vcsError(fmt.Errorf("could not list tags: %v", err))
+  }
+  for _, e := range tags {
+    if e == version {
+      return vcsError(repo.vcs.tagSync(dir, version))
+    }
+  }
+  
+  // not a tag or branch, assume it's a revision
+  return vcsError(repo.vcs.revisionSync(dir, version))
+}
+
+/**
+ * Split a package argument of the form 'package@version' into its components
+ */
+func splitVersion(arg string) (string, string) {
+  if i := strings.LastIndex(arg, "@"); i > 0 {
+    return arg[:i], arg[i+1:]
+  }
+  return arg, ""
+}
+
 /**
  * Infer package dependencies
  */
 func packageDeps(dir string, opts inferOptions) ([]string, error) {
   
-  imp, err := importsForSourceDir(dir, looksLikeADomainNameFilter, opts)
+  imp, err := importsForSourceDir(dir, externalPackageFilter(opts), opts)
   if err != nil {
-    return nil, fmt.Errorf("could not infer dependencies: %v\n", err)
+    return nil, parseError(fmt.Errorf("could not infer dependencies: %v\n", err))
   }
   
   return imp, nil
@@ -0,0 +1,225 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "io"
+  "fmt"
+  "path"
+  "encoding/json"
+)
+
+/**
+ * An import graph records the packages discovered while scanning, the
+ * repositories they belong to and the packages each of them imports
+ */
+type importGraph struct {
+  Imports map[string]map[string]struct{} // package -> imported packages
+  Repos   map[string]string              // package -> repository root
+}
+
+/**
+ * Create an import graph
+ */
+func newImportGraph() *importGraph {
+  return &importGraph{
+    Imports: make(map[string]map[string]struct{}),
+    Repos: make(map[string]string),
+  }
+}
+
+/**
+ * Add a package which belongs to the repository with the provided root
+ */
+func (g *importGraph) AddPackage(pkg, root string) {
+  if _, ok := g.Imports[pkg]; !ok {
+    g.Imports[pkg] = make(map[string]struct{})
+  }
+  if root != "" {
+    g.Repos[pkg] = root
+  }
+}
+
+/**
+ * Add an edge from a package to a package it imports
+ */
+func (g *importGraph) AddImport(pkg, imp string) {
+  g.AddPackage(pkg, "")
+  g.AddPackage(imp, "")
+  g.Imports[pkg][imp] = struct{}{}
+}
+
+/**
+ * Add the imports of every package in a directory hierarchy, given the import
+ * path of the directory and the root of the repository it belongs to
+ */
+func (g *importGraph) AddDir(dir, pkg, root string, opts inferOptions) error {
+  opts.Packages = true // edges are always between individual packages
+  
+  pkgs, err := packagesInDir(dir, pkg, opts)
+  if err != nil {
+    return err
+  }
+  
+  g.AddPackage(pkg, root)
+  for _, e := range append([]string{pkg}, pkgs...) {
+    
+    imp, err := importsForSourceDir(path.Join(dir, e[len(pkg):]), externalPackageFilter(opts), opts)
+    if err != nil {
+      return parseError(err)
+    }
+    
+    if len(imp) > 0 {
+      g.AddPackage(e, root)
+    }
+    for _, d := range imp {
+      g.AddImport(e, d)
+    }
+    
+  }
+  
+  return nil
+}
+
+/**
+ * Obtain the packages in the graph in order
+ */
+func (g *importGraph) Packages() []string {
+  return sortedGraphKeys(g.Imports)
+}
+
+/**
+ * Obtain the repositories in the graph, each mapped to the repositories its
+ * packages import. Packages whose repository is unknown are their own repository.
+ */
+func (g *importGraph) RepoImports() map[string]map[string]struct{} {
+  repos := make(map[string]map[string]struct{})
+  root := func(p string) string {
+    if r, ok := g.Repos[p]; ok {
+      return r
+    }
+    return p
+  }
+  for p, imp := range g.Imports {
+    r := root(p)
+    if _, ok := repos[r]; !ok {
+      repos[r] = make(map[string]struct{})
+    }
+    for d, _ := range imp {
+      if dr := root(d); dr != r {
+        repos[r][dr] = struct{}{}
+      }
+    }
+  }
+  return repos
+}
+
+/**
+ * Write the graph in Graphviz DOT format, either between packages or between
+ * the repositories they belong to
+ */
+func (g *importGraph) WriteDOT(w io.Writer, repos bool) error {
+  
+  edges := g.Imports
+  if repos {
+    edges = g.RepoImports()
+  }
+  
+  _, err := fmt.Fprintf(w, "digraph imports {\n")
+  if err != nil {
+    return err
+  }
+  
+  for _, e := range sortedGraphKeys(edges) {
+    deps := sortedSet(edges[e])
+    if len(deps) < 1 {
+      _, err = fmt.Fprintf(w, "  %q;\n", e) // so it's not left out entirely
+    }
+    for _, d := range deps {
+      if err == nil {
+        _, err = fmt.Fprintf(w, "  %q -> %q;\n", e, d)
+      }
+    }
+    if err != nil {
+      return err
+    }
+  }
+  
+  _, err = fmt.Fprintf(w, "}\n")
+  return err
+}
+
+/**
+ * A package in a JSON graph
+ */
+type graphPackage struct {
+  Path    string    `json:"path"`
+  Repo    string    `json:"repo,omitempty"`
+  Imports []string  `json:"imports"`
+}
+
+/**
+ * A repository in a JSON graph
+ */
+type graphRepo struct {
+  Root    string    `json:"root"`
+  Imports []string  `json:"imports"`
+}
+
+/**
+ * Write the graph in JSON, including both package and repository edges
+ */
+func (g *importGraph) WriteJSON(w io.Writer) error {
+  
+  var out struct {
+    Packages  []graphPackage  `json:"packages"`
+    Repos     []graphRepo     `json:"repos"`
+  }
+  
+  out.Packages = make([]graphPackage, 0, len(g.Imports))
+  for _, e := range g.Packages() {
+    out.Packages = append(out.Packages, graphPackage{e, g.Repos[e], sortedSet(g.Imports[e])})
+  }
+  
+  repos := g.RepoImports()
+  out.Repos = make([]graphRepo, 0, len(repos))
+  for _, e := range sortedGraphKeys(repos) {
+    out.Repos = append(out.Repos, graphRepo{e, sortedSet(repos[e])})
+  }
+  
+  data, err := json.MarshalIndent(out, "", "  ")
+  if err != nil {
+    return err
+  }
+  
+  _, err = w.Write(append(data, '\n'))
+  return err
+}
@@ -0,0 +1,132 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "os"
+  "io"
+  "fmt"
+  "crypto/sha256"
+  "path/filepath"
+)
+
+const treeHashPrefix = "sha256:"
+
+/**
+ * Compute a deterministic hash of the files in a directory hierarchy, ignoring
+ * VCS metadata. The hash covers the path and content of every file (or the
+ * target of every symlink) in lexical order, so files which are modified, added
+ * or deleted all change it. Empty directories are not considered.
+ */
+func treeHash(dir string) (string, error) {
+  sum := sha256.New()
+  
+  err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+    if info.IsDir() {
+      if p != dir && vcsFileFilter(p) {
+        return filepath.SkipDir
+      }
+      return nil
+    }
+    
+    rel, err := filepath.Rel(dir, p)
+    if err != nil {
+      return err
+    }
+    
+    h, err := fileHash(p, info)
+    if err != nil {
+      return err
+    }
+    
+    fmt.Fprintf(sum, "%x  %s\n", h, filepath.ToSlash(rel))
+    return nil
+  })
+  if err != nil {
+    return "", fmt.Errorf("could not hash %v: %v", dir, err)
+  }
+  
+  return fmt.Sprintf("%v%x", treeHashPrefix, sum.Sum(nil)), nil
+}
+
+/**
+ * Hash the content of a file or the target of a symlink
+ */
+func fileHash(p string, info os.FileInfo) ([]byte, error) {
+  sum := sha256.New()
+  
+  if info.Mode() & os.ModeSymlink != 0 {
+    t, err := os.Readlink(p)
+    if err != nil {
+      return nil, err
+    }
+    io.WriteString(sum, "symlink:"+t)
+    return sum.Sum(nil), nil
+  }
+  
+  file, err := os.Open(p)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+  
+  _, err = io.Copy(sum, file)
+  if err != nil {
+    return nil, err
+  }
+  
+  return sum.Sum(nil), nil
+}
+
+/**
+ * Check the checksum of a fetched repository against the one recorded for its
+ * revision. If there is none it is recorded. A working copy which was updated
+ * in place may have local modifications, so it's only checked when it's a
+ * fresh copy.
+ */
+func checkRepoSum(entry *lockEntry, dir string, repo *repoRoot, fresh bool) error {
+  
+  sum, err := treeHash(dir)
+  if err != nil {
+    return err
+  }
+  
+  if entry.Sum == "" {
+    entry.Sum = sum
+  }else if fresh && entry.Sum != sum {
+    return checksumError(fmt.Errorf("checksum mismatch for %v at revision %v: expected %v, got %v from %v; refusing to proceed", repo.root, entry.Revision, entry.Sum, sum, repo.repo))
+  }
+  
+  return nil
+}
@@ -0,0 +1,100 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+
+package main
+
+import (
+  "os"
+  "path"
+  "testing"
+  "io/ioutil"
+)
+
+/**
+ * Test hashing trees deterministically
+ */
+func TestTreeHash(t *testing.T) {
+  
+  base, err := ioutil.TempDir("", "gofetch-test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(base)
+  
+  files := map[string]string{
+    "a.go":       "package a\n",
+    "b/b.go":     "package b\n",
+    "b/c/c.txt":  "c\n",
+  }
+  
+  tests := []struct {
+    Name  string
+    Files map[string]string // files written in addition to the base ones
+    Dirs  []string          // empty directories created
+    Same  bool              // the hash is the same as that of the base files
+  }{
+    {"base", nil, nil, true},
+    {"vcs", map[string]string{".git/HEAD": "ref: refs/heads/master\n", "b/.hg/store": "x"}, nil, true},
+    {"empty directory", nil, []string{"d/e"}, true},
+    {"modified", map[string]string{"a.go": "package a // edited\n"}, nil, false},
+    {"added", map[string]string{"b/c/d.txt": "d\n"}, nil, false},
+    {"renamed content", map[string]string{"b/c/c.txt": "", "b/c/x.txt": "c\n"}, nil, false},
+  }
+  
+  var expect string
+  for i, e := range tests {
+    dir := path.Join(base, e.Name)
+    writeTestTree(t, dir, files)
+    writeTestTree(t, dir, e.Files)
+    for _, d := range e.Dirs {
+      err = os.MkdirAll(path.Join(dir, d), 0755)
+      if err != nil {
+        t.Fatal(err)
+      }
+    }
+    
+    h, err := treeHash(dir)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if again, err := treeHash(dir); err != nil || again != h {
+      t.Errorf("%v: hashing again produced %v (%v); expected %v", e.Name, again, err, h)
+    }
+    
+    if i == 0 {
+      expect = h
+    }else if e.Same && h != expect {
+      t.Errorf("%v: hash %v; expected %v", e.Name, h, expect)
+    }else if !e.Same && h == expect {
+      t.Errorf("%v: hash %v; expected it to differ", e.Name, h)
+    }
+  }
+}
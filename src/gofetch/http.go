@@ -40,6 +40,9 @@ func (e *httpError) Error() string {
 
 // httpGET returns the data from an HTTP GET request for the given URL.
 func httpGET(url string) ([]byte, error) {
+	if optOffline {
+		return nil, errOffline
+	}
 	resp, err := httpClient.Get(url)
 	if err != nil {
 		return nil, err
@@ -60,6 +63,9 @@ func httpGET(url string) ([]byte, error) {
 // httpsOrHTTP returns the body of either the importPath's
 // https resource or, if unavailable, the http resource.
 func httpsOrHTTP(importPath string, security securityMode) (urlStr string, body io.ReadCloser, err error) {
+	if optOffline {
+		return "", nil, errOffline
+	}
 	fetch := func(scheme string) (urlStr string, res *http.Response, err error) {
 		u, err := url.Parse(scheme + "://" + importPath)
 		if err != nil {
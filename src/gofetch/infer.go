@@ -35,13 +35,13 @@ import (
   "io"
   "fmt"
   "path"
+  "sort"
   "regexp"
   "strings"
   "go/token"
   "go/parser"
 )
 
-var domainPrefixRegex = regexp.MustCompile("^[a-zA-Z0-9]([a-zA-Z0-9\\-]*[a-zA-Z0-9])\\.([a-zA-Z0-9]{2,20})")
 var privatePathRegex  = regexp.MustCompile("(^|\\/)([_].*|Godep|third_party|pkg)($|\\/)")
 
 var defaultExcludePackages = []string{
@@ -55,7 +55,12 @@ var defaultExcludePackages = []string{
  */
 type inferOptions struct {
   ExcludeFilter pathFilter
+  Build *buildContext
+  Packages bool // infer the imports of individual packages rather than entire repositories
+  GoVersion int // the minor version of the target Go release, or -1 for any release
+  Local []string // import path prefixes which are local to the project
   ListPaths, ListPackages bool
+  Graph *importGraph // if not nil, the import graph is recorded here
 }
 
 /**
@@ -71,10 +76,22 @@ func excludePackage(n string, s []string) bool {
 }
 
 /**
- * Exclude imports that don't start with what looks like a "domain.name"
+ * Produce a filter which excludes imports that are not external: standard library
+ * packages for the target Go release, relative imports, packages local to the
+ * project and packages that look private
  */
-func looksLikeADomainNameFilter(n string) bool {
-  return domainPrefixRegex.MatchString(n) && !privatePathRegex.MatchString(n) && !excludePackage(n, defaultExcludePackages)
+func externalPackageFilter(opts inferOptions) pathFilter {
+  return func(n string) bool {
+    switch {
+      case n == "" || n[0] == '.' || n[0] == '/':
+        return false
+      case isStandardPackage(n, opts.GoVersion):
+        return false
+      case isLocalPackage(n, opts.Local):
+        return false
+    }
+    return !privatePathRegex.MatchString(n) && !excludePackage(n, defaultExcludePackages)
+  }
 }
 
 /**
@@ -115,8 +132,7 @@ func looksPrivateSourceFilter(n string) bool {
  */
 func importsForSourceDir(dir string, filter pathFilter, opts inferOptions) ([]string, error) {
   
-  set := make(map[string]struct{})
-  err := importsForSourceDirInc(set, dir, true, filter, opts)
+  set, err := importSourcesForSourceDir(dir, filter, opts)
   if err != nil {
     return nil, err
   }
@@ -128,13 +144,28 @@ func importsForSourceDir(dir string, filter pathFilter, opts inferOptions) ([]st
     i++
   }
   
+  sort.Strings(imp)
+  
   return imp, nil
 }
 
 /**
- * Incremental imports
+ * Imports, each mapped to the path of a source file which imports it
  */
-func importsForSourceDirInc(imp map[string]struct{}, dir string, rec bool, filter pathFilter, opts inferOptions) error {
+func importSourcesForSourceDir(dir string, filter pathFilter, opts inferOptions) (map[string]string, error) {
+  imp := make(map[string]string)
+  err := importsForSourceDirInc(imp, dir, !opts.Packages, filter, opts)
+  if err != nil {
+    return nil, err
+  }
+  return imp, nil
+}
+
+/**
+ * Incremental imports. When more than one source file imports a package, the
+ * first one by name is noted.
+ */
+func importsForSourceDirInc(imp map[string]string, dir string, rec bool, filter pathFilter, opts inferOptions) error {
   
   name := path.Base(dir)
   if len(name) < 1 || name[0] == '.' {
@@ -161,7 +192,7 @@ func importsForSourceDirInc(imp map[string]struct{}, dir string, rec bool, filte
     return err
   }
   
-  fset := token.NewFileSet()
+  srcs := make(map[string]struct{})
   for _, e := range items {
     name = e.Name()
     abs := path.Join(dir, name)
@@ -173,7 +204,9 @@ func importsForSourceDirInc(imp map[string]struct{}, dir string, rec bool, filte
         continue // ignore empty files
       }
       if strings.EqualFold(path.Ext(name), ".go") {
-        fset.AddFile(abs, -1, int(e.Size()))
+        if opts.Build.MatchFile(abs) {
+          srcs[name] = struct{}{}
+        }
       }
     }else if rec {
       err := importsForSourceDirInc(imp, abs, rec, filter, opts)
@@ -183,20 +216,32 @@ func importsForSourceDirInc(imp map[string]struct{}, dir string, rec bool, filte
     }
   }
   
-  pkgs, err := parser.ParseDir(fset, dir, nil, parser.ImportsOnly)
+  // only parse the sources we've accepted, if we're being selective; otherwise
+  // every source in the directory is parsed, as it always has been
+  var include func(os.FileInfo) bool
+  if !opts.Build.All() {
+    include = func(info os.FileInfo) bool {
+      _, ok := srcs[info.Name()]
+      return ok
+    }
+  }
+  
+  pkgs, err := parser.ParseDir(token.NewFileSet(), dir, include, parser.ImportsOnly)
   if err != nil {
     return err
   }
   
   for _, e := range pkgs {
     if e.Files != nil {
-      for _, f := range e.Files {
+      for n, f := range e.Files {
         if f.Imports != nil {
           for _, v := range f.Imports {
             if lit := v.Path.Value; len(lit) > 2 {
               str := lit[1:len(lit)-1]
               if filter == nil || filter(str) {
-                imp[str] = struct{}{}
+                if s, ok := imp[str]; !ok || n < s {
+                  imp[str] = n
+                }
               }
             }
           }
@@ -208,3 +253,131 @@ func importsForSourceDirInc(imp map[string]struct{}, dir string, rec bool, filte
   return nil
 }
 
+
+/**
+ * Walk the packages reachable from the provided roots, breadth-first, by
+ * following their imports through the sources in the directories provided by
+ * the dir function. Roots may also be paths to directories. If repositories are
+ * provided, the packages in the same repository as a package are also followed,
+ * once per repository. Packages which are not present are not followed.
+ * 
+ * The visit function is called once for every package, in the order it is
+ * found, with the package it was found through (nothing for roots) and the
+ * source file which imports it (nothing for roots and for packages in the same
+ * repository). The walk stops when the visit function returns false.
+ */
+func walkImports(roots []string, dir func(string) string, repos *lockfile, opts inferOptions, visit func(pkg, parent, source string) bool) error {
+  opts.Packages = true // we're always interested in individual packages here
+  
+  visited := make(map[string]struct{})
+  expanded := make(map[string]struct{})
+  dirs := make(map[string]string)
+  queue := make([]string, 0, len(roots))
+  
+  // note a package, unless it's been seen already; false if the walk is over
+  add := func(pkg, parent, source, abs string) bool {
+    if _, ok := visited[pkg]; ok {
+      return true
+    }
+    visited[pkg] = struct{}{}
+    dirs[pkg] = abs
+    queue = append(queue, pkg)
+    return visit(pkg, parent, source)
+  }
+  
+  for _, e := range roots {
+    abs := dir(e)
+    if !isDir(abs) && isDir(e) {
+      abs = e // a path rather than a package
+    }
+    if !add(e, "", "", abs) {
+      return nil
+    }
+  }
+  
+  for len(queue) > 0 {
+    e := queue[0]
+    queue = queue[1:]
+    
+    if !isDir(dirs[e]) {
+      continue // not present, nothing to follow
+    }
+    
+    src, err := importSourcesForSourceDir(dirs[e], externalPackageFilter(opts), opts)
+    if err != nil {
+      return parseError(fmt.Errorf("could not infer dependencies: %v\n", err))
+    }
+    
+    deps := make([]string, 0, len(src))
+    for d, _ := range src {
+      deps = append(deps, d)
+    }
+    sort.Strings(deps) // for a consistent order
+    
+    for _, d := range deps {
+      if !add(d, e, src[d], dir(d)) {
+        return nil
+      }
+    }
+    
+    // follow the other packages in the same repository, once per repository
+    if repos == nil {
+      continue
+    }
+    repo, ok := repos.RepoRoot(e)
+    if !ok || !isDir(dir(repo.root)) {
+      continue
+    }
+    if _, ok := expanded[repo.root]; ok {
+      continue
+    }
+    expanded[repo.root] = struct{}{}
+    
+    pkgs, err := packagesInDir(dir(repo.root), repo.root, opts)
+    if err != nil {
+      return err
+    }
+    for _, d := range pkgs {
+      if !add(d, e, "", dir(d)) {
+        return nil
+      }
+    }
+  }
+  
+  return nil
+}
+
+/**
+ * List the packages in a directory hierarchy, in order, given the import path
+ * of the directory. Directories which look private are not considered.
+ */
+func packagesInDir(dir, pkg string, opts inferOptions) ([]string, error) {
+  
+  file, err := os.Open(dir)
+  if err != nil {
+    return nil, err
+  }
+  items, err := file.Readdir(0)
+  file.Close()
+  if err != nil {
+    return nil, err
+  }
+  
+  var pkgs []string
+  sort.Slice(items, func(i, j int) bool { return items[i].Name() < items[j].Name() })
+  for _, e := range items {
+    name := e.Name()
+    abs := path.Join(dir, name)
+    if !e.IsDir() || name[0] == '.' || (opts.ExcludeFilter != nil && !opts.ExcludeFilter(abs)) {
+      continue
+    }
+    sub, err := packagesInDir(abs, path.Join(pkg, name), opts)
+    if err != nil {
+      return nil, err
+    }
+    pkgs = append(pkgs, path.Join(pkg, name))
+    pkgs = append(pkgs, sub...)
+  }
+  
+  return pkgs, nil
+}
@@ -0,0 +1,348 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+
+package main
+
+import (
+  "os"
+  "fmt"
+  "path"
+  "sort"
+  "sync"
+  "strings"
+  "io/ioutil"
+  "encoding/json"
+)
+
+const defaultLockfile = "gofetch.lock"
+
+/**
+ * A locked repository
+ */
+type lockEntry struct {
+  VCS       string  `json:"vcs"`
+  Repo      string  `json:"repo"`
+  Version   string  `json:"version,omitempty"`
+  Revision  string  `json:"revision,omitempty"`
+  Sum       string  `json:"sum,omitempty"`  // the hash of the tree at the revision, before stripping
+  Hash      string  `json:"hash,omitempty"` // the hash of the vendored tree, after stripping
+}
+
+/**
+ * A lockfile records the repositories that have been fetched, keyed by
+ * their root import path. A lockfile is safe for concurrent use.
+ */
+type lockfile struct {
+  sync.Mutex
+  Packages  []string              `json:"packages,omitempty"` // the packages requested on the command line
+  Repos     map[string]lockEntry  `json:"repos"`
+}
+
+/**
+ * Create an empty lockfile
+ */
+func newLockfile() *lockfile {
+  return &lockfile{Repos: make(map[string]lockEntry)}
+}
+
+/**
+ * Determine the path to a lockfile. Relative names are resolved against the
+ * output directory.
+ */
+func lockfilePath(outbase, name string) string {
+  if name == "" || path.IsAbs(name) {
+    return name
+  }
+  return path.Join(outbase, name)
+}
+
+/**
+ * Read a lockfile. If the file does not exist an empty lockfile is returned.
+ */
+func readLockfile(p string) (*lockfile, error) {
+  
+  data, err := ioutil.ReadFile(p)
+  if os.IsNotExist(err) {
+    return newLockfile(), nil
+  }else if err != nil {
+    return nil, fmt.Errorf("could not read lockfile: %v", err)
+  }
+  
+  lock := newLockfile()
+  err = json.Unmarshal(data, lock)
+  if err != nil {
+    return nil, parseError(fmt.Errorf("could not parse lockfile: %v: %v", p, err))
+  }
+  if lock.Repos == nil {
+    lock.Repos = make(map[string]lockEntry)
+  }
+  
+  return lock, nil
+}
+
+/**
+ * Write a lockfile
+ */
+func (l *lockfile) Write(p string) error {
+  l.Lock()
+  data, err := json.MarshalIndent(l, "", "  ")
+  l.Unlock()
+  if err != nil {
+    return err
+  }
+  
+  err = ioutil.WriteFile(p, append(data, '\n'), 0644)
+  if err != nil {
+    return fmt.Errorf("could not write lockfile: %v", err)
+  }
+  
+  return nil
+}
+
+/**
+ * Obtain the root import paths of every locked repository in order
+ */
+func (l *lockfile) Roots() []string {
+  l.Lock()
+  defer l.Unlock()
+  roots := make([]string, 0, len(l.Repos))
+  for k, _ := range l.Repos {
+    roots = append(roots, k)
+  }
+  sort.Strings(roots)
+  return roots
+}
+
+/**
+ * Note packages which have been requested on the command line
+ */
+func (l *lockfile) AddPackages(pkgs ...string) {
+  l.Lock()
+  defer l.Unlock()
+  for _, e := range pkgs {
+    if !containsString(l.Packages, e) {
+      l.Packages = append(l.Packages, e)
+    }
+  }
+  sort.Strings(l.Packages)
+}
+
+/**
+ * Forget the requested packages which are in the repository with the provided
+ * root import path
+ */
+func (l *lockfile) RemovePackages(root string) {
+  l.Lock()
+  defer l.Unlock()
+  var pkgs []string
+  for _, e := range l.Packages {
+    if e != root && !strings.HasPrefix(e, root+"/") {
+      pkgs = append(pkgs, e)
+    }
+  }
+  l.Packages = pkgs
+}
+
+/**
+ * Obtain the packages which have been requested on the command line in order
+ */
+func (l *lockfile) RequestedPackages() []string {
+  l.Lock()
+  defer l.Unlock()
+  return append([]string(nil), l.Packages...)
+}
+
+/**
+ * Obtain the entry for a locked repository, if there is one. A nil lockfile has
+ * no entries.
+ */
+func (l *lockfile) Lookup(root string) (lockEntry, bool) {
+  if l == nil {
+    return lockEntry{}, false
+  }
+  l.Lock()
+  defer l.Unlock()
+  e, ok := l.Repos[root]
+  return e, ok
+}
+
+/**
+ * Obtain the entry for a locked repository or the zero entry if there isn't one
+ */
+func (l *lockfile) Get(root string) lockEntry {
+  e, _ := l.Lookup(root)
+  return e
+}
+
+/**
+ * Set the entry for a locked repository
+ */
+func (l *lockfile) Set(root string, e lockEntry) {
+  l.Lock()
+  defer l.Unlock()
+  l.Repos[root] = e
+}
+
+/**
+ * Remove the entry for a locked repository
+ */
+func (l *lockfile) Delete(root string) {
+  l.Lock()
+  defer l.Unlock()
+  delete(l.Repos, root)
+}
+
+/**
+ * Find the locked repository which contains the provided package, if any
+ */
+func (l *lockfile) RepoRoot(pkg string) (*repoRoot, bool) {
+  l.Lock()
+  defer l.Unlock()
+  var match *repoRoot
+  for root, e := range l.Repos {
+    if pkg != root && !strings.HasPrefix(pkg, root+"/") {
+      continue
+    }
+    if match != nil && len(match.root) > len(root) {
+      continue // prefer the most specific root
+    }
+    if vcs := vcsByCmd(e.VCS); vcs != nil {
+      match = &repoRoot{vcs: vcs, repo: e.Repo, root: root}
+    }
+  }
+  return match, match != nil
+}
+
+/**
+ * Determine if a directory contains VCS metadata for the provided VCS
+ */
+func hasVCSMetadata(dir string, vcs *vcsCmd) bool {
+  _, err := os.Stat(path.Join(dir, "."+vcs.cmd))
+  return err == nil
+}
+
+/**
+ * Determine the locked state of a fetched repository, including the version
+ * that was requested for it, if any. This must be done before VCS files are
+ * stripped, otherwise we have no way to determine the revision. If the
+ * repository was not updated and its VCS files have already been stripped, the
+ * previously locked entry is retained. The checksum and hash of the tree are
+ * retained as long as the revision hasn't changed; it's up to the caller to
+ * verify or update them when the tree is replaced.
+ */
+func repoLockEntry(lock *lockfile, dir string, repo *repoRoot, version string) (lockEntry, error) {
+  
+  entry := lockEntry{
+    VCS: repo.vcs.cmd,
+    Repo: repo.repo,
+    Version: version,
+  }
+  
+  if hasVCSMetadata(dir, repo.vcs) {
+    rev, err := repo.vcs.revision(dir)
+    if err != nil {
+      return lockEntry{}, vcsError(fmt.Errorf("could not determine revision: %v", err))
+    }
+    entry.Revision = rev
+    if e, ok := lock.Lookup(repo.root); ok && e.Revision == rev {
+      entry.Sum, entry.Hash = e.Sum, e.Hash // the same tree, unless it's replaced
+      if version == "" {
+        entry.Version = e.Version // still at the version previously requested
+      }
+    }
+  }else if e, ok := lock.Lookup(repo.root); ok {
+    entry = e
+  }
+  
+  return entry, nil
+}
+
+/**
+ * Make sure a fetched repository is the one recorded in the lockfile: its import
+ * path must resolve to the same remote repository and, when the tag it was locked
+ * at is requested again, the tag must still refer to the same revision. Tags
+ * aren't expected to move; when one does, upstream has been tampered with.
+ */
+func checkLockedRepo(lock *lockfile, entry lockEntry, dir string, repo *repoRoot, version string) error {
+  
+  prev, ok := lock.Lookup(repo.root)
+  if !ok {
+    return nil
+  }
+  
+  if prev.Repo != "" && prev.Repo != repo.repo {
+    return checksumError(fmt.Errorf("%v resolves to %v, but it's locked to %v; refusing to proceed", repo.root, repo.repo, prev.Repo))
+  }
+  
+  // branches and queries are expected to move, only tags are checked
+  if version == "" || version != prev.Version || isVersionQuery(version) {
+    return nil
+  }
+  if prev.Revision == "" || prev.Revision == entry.Revision {
+    return nil
+  }
+  
+  tags, err := repo.vcs.releaseTags(dir)
+  if err != nil {
+    return vcsError(fmt.Errorf("could not list tags: %v", err))
+  }
+  if containsString(tags, version) {
+    return checksumError(fmt.Errorf("tag %v of %v is locked at revision %v, but refers to %v in %v; refusing to proceed", version, repo.root, prev.Revision, entry.Revision, repo.repo))
+  }
+  
+  return nil
+}
+
+/**
+ * Check out the locked revision of a fetched repository, if there is one. If
+ * the repository has already had its VCS files stripped it is left as-is.
+ */
+func syncLockedRepo(lock *lockfile, dir string, repo *repoRoot) error {
+  
+  e, ok := lock.Lookup(repo.root)
+  if !ok || e.Revision == "" {
+    return nil
+  }
+  if !hasVCSMetadata(dir, repo.vcs) {
+    return nil
+  }
+  
+  if optVerbose {
+    notice("%v: %v locked at %v", cmd, repo.root, e.Revision)
+  }
+  
+  err := repo.vcs.revisionSync(dir, e.Revision)
+  if err != nil {
+    return vcsError(fmt.Errorf("could not check out locked revision %v of %v: %v", e.Revision, repo.root, err))
+  }
+  
+  return nil
+}
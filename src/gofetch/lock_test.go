@@ -0,0 +1,145 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+
+package main
+
+import (
+  "os"
+  "path"
+  "strings"
+  "testing"
+  "os/exec"
+  "io/ioutil"
+)
+
+/**
+ * Run git in a directory, failing the test if it doesn't succeed
+ */
+func runTestGit(t *testing.T, dir string, args ...string) {
+  cmd := exec.Command("git", append([]string{"-c", "user.name=gofetch", "-c", "user.email=gofetch@example.com"}, args...)...)
+  cmd.Dir = dir
+  out, err := cmd.CombinedOutput()
+  if err != nil {
+    t.Fatalf("git %v: %v\n%s", strings.Join(args, " "), err, out)
+  }
+}
+
+/**
+ * Test refusing to fetch a locked tag which has been moved upstream, or a locked
+ * repository which now resolves to a different remote
+ */
+func TestFetchLockedRepo(t *testing.T) {
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git is not available")
+  }
+  
+  base, err := ioutil.TempDir("", "gofetch-test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(base)
+  
+  cache := optCacheDir
+  optCacheDir = "" // fetch directly from the upstream repository
+  defer func() { optCacheDir = cache }()
+  
+  upstream := path.Join(base, "upstream")
+  writeTestTree(t, upstream, map[string]string{
+    "a.go": "package a\n",
+  })
+  runTestGit(t, upstream, "init", "-q")
+  runTestGit(t, upstream, "add", "-A")
+  runTestGit(t, upstream, "commit", "-q", "-m", "initial")
+  runTestGit(t, upstream, "tag", "v1.0.0")
+  runTestGit(t, upstream, "branch", "stable")
+  
+  outbase := path.Join(base, "out")
+  dir := path.Join(outbase, "x.com/a")
+  lock := newLockfile()
+  opts := fetchOptions{
+    Versions: map[string]string{"x.com/a": "v1.0.0"},
+    InferOptions: inferOptions{GoVersion: -1},
+  }
+  
+  fetch := func(remote string) error {
+    err := os.RemoveAll(dir) // always a fresh copy
+    if err != nil {
+      t.Fatal(err)
+    }
+    repo := &repoRoot{vcs: vcsGit, repo: remote, root: "x.com/a"}
+    return fetchRepoSources(newFetchState(lock), "x.com/a", dir, outbase, nil, repo, opts, func(*event){})
+  }
+  
+  // the first fetch is locked and the tag can be fetched again
+  for i := 0; i < 2; i++ {
+    if err := fetch(upstream); err != nil {
+      t.Fatalf("fetch #%d: %v", i, err)
+    }
+  }
+  locked := lock.Get("x.com/a")
+  if locked.Version != "v1.0.0" || locked.Revision == "" {
+    t.Fatalf("unexpected lock entry: %+v", locked)
+  }
+  
+  // a fork of the locked repository is refused, even at the same revision
+  fork := path.Join(base, "fork")
+  runTestGit(t, base, "clone", "-q", upstream, fork)
+  err = fetch(fork)
+  if c := exitCode(err); c != exitChecksum {
+    t.Errorf("fetching a different repository: exit code %d (%v); expected %d", c, err, exitChecksum)
+  }
+  
+  // force-move the tag to a new commit
+  writeTestTree(t, upstream, map[string]string{
+    "a.go": "package a\n\nvar Tampered = true\n",
+  })
+  runTestGit(t, upstream, "commit", "-q", "-a", "-m", "tampered")
+  runTestGit(t, upstream, "tag", "-f", "v1.0.0")
+  
+  err = fetch(upstream)
+  if c := exitCode(err); c != exitChecksum {
+    t.Errorf("fetching a moved tag: exit code %d (%v); expected %d", c, err, exitChecksum)
+  }
+  if isDir(dir) {
+    t.Errorf("a moved tag was fetched into %v", dir)
+  }
+  if e := lock.Get("x.com/a"); e != locked {
+    t.Errorf("lock entry changed after a refused fetch: %+v; expected %+v", e, locked)
+  }
+  
+  // a branch is expected to move
+  opts.Versions["x.com/a"] = "stable"
+  lock.Set("x.com/a", lockEntry{VCS: "git", Repo: upstream, Version: "stable", Revision: locked.Revision})
+  runTestGit(t, upstream, "branch", "-f", "stable", "HEAD")
+  if err := fetch(upstream); err != nil {
+    t.Errorf("fetching a branch which moved: %v", err)
+  }
+}
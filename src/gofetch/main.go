@@ -35,7 +35,10 @@ import (
   "fmt"
   "flag"
   "path"
+  "sync"
+  "time"
   "strings"
+  "io/ioutil"
 )
 
 var go15VendorExperiment bool
@@ -46,6 +49,15 @@ var buildX bool // -x flag
 var optVerbose bool
 var optDebug bool
 var optMapPackages stringList
+var optCacheDir string
+var optOffline bool
+var optRefreshDiscovery bool
+var optDiscoveryTTL time.Duration
+var optBuildOS, optBuildArch, optBuildTags string
+var optPackageDeps bool
+var optGoVersion string
+var optLocalPackages stringList
+var optJSON bool
 
 var cmd = path.Base(os.Args[0])
 var cmdline = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
@@ -54,9 +66,20 @@ var cmdline = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
  * Init
  */
 func init() {
-  cmdline.BoolVar (&optVerbose,     "verbose",  false,  "Be verbose.")
-  cmdline.BoolVar (&optDebug,       "debug",    false,  "Be even more verbose.")
-  cmdline.Var     (&optMapPackages, "map",              "Explicitly map a package to its root (e.g., 'github.com/a/b/c/d=github.com/a/b'). This can be used to correct for broken or badly behaving repos.")
+  cmdline.BoolVar     (&optVerbose,           "verbose",            false,                "Be verbose.")
+  cmdline.BoolVar     (&optDebug,             "debug",              false,                "Be even more verbose.")
+  cmdline.Var         (&optMapPackages,       "map",                                      "Explicitly map a package to its root (e.g., 'github.com/a/b/c/d=github.com/a/b'). This can be used to correct for broken or badly behaving repos.")
+  cmdline.StringVar   (&optCacheDir,          "cache",              defaultCacheDir(),    "The directory in which to cache repository mirrors and discovered import paths, which are shared between projects. Pass an empty value to disable.")
+  cmdline.BoolVar     (&optOffline,           "offline",            false,                "Do not access the network. Packages are resolved and fetched only from the cache.")
+  cmdline.BoolVar     (&optRefreshDiscovery,  "refresh-discovery",  false,                "Ignore cached import path discovery results and resolve every import path again.")
+  cmdline.DurationVar (&optDiscoveryTTL,      "discovery-ttl",      defaultDiscoveryTTL,  "How long cached import path discovery results are used before they are resolved again.")
+  cmdline.StringVar   (&optBuildOS,           "os",                 allBuildValues,       "Only consider sources built for these operating systems (comma-separated, or 'all').")
+  cmdline.StringVar   (&optBuildArch,         "arch",               allBuildValues,       "Only consider sources built for these architectures (comma-separated, or 'all').")
+  cmdline.StringVar   (&optBuildTags,         "tags",               allBuildValues,       "Only consider sources built with these build tags (comma-separated, or 'all' to allow any tags).")
+  cmdline.StringVar   (&optGoVersion,         "go",                 defaultGoVersion(),   "The Go release whose standard library packages are not fetched (e.g., '1.21', or 'all').")
+  cmdline.Var         (&optLocalPackages,     "local",                                    "Treat packages with this import path prefix as local to the project, rather than fetching them (e.g., 'git.example.com/team'). May be repeated.")
+  cmdline.BoolVar     (&optPackageDeps,       "package-deps",       false,                "Follow only the imports of the packages that are actually used, rather than those of every package in their repositories.")
+  cmdline.BoolVar     (&optJSON,              "json",               false,                "Report what happens to each package as a JSON object per line.")
 }
 
 /**
@@ -64,6 +87,9 @@ func init() {
  */
 func usage() {
   fmt.Printf("usage: %v (fetch|scan) [-options] package1 [package2 ...]\n", cmd)
+  fmt.Printf("       %v why [-options] package\n", cmd)
+  fmt.Printf("       %v remove [-options] package1 [package2 ...]\n", cmd)
+  fmt.Printf("       %v (status|outdated|verify) [-options]\n", cmd)
 }
 
 /**
@@ -73,21 +99,37 @@ func main() {
   
   if len(os.Args) < 2 {
     usage()
-    return
+    os.Exit(exitUsage)
   }
   
   go15VendorExperiment = os.Getenv("GO15VENDOREXPERIMENT") != ""
   
+  var err error
   act := os.Args[1]
   switch {
     case strings.HasPrefix("fetch", act):
-      fetch(os.Args[2:])
+      err = fetch(os.Args[2:])
     case strings.HasPrefix("scan", act):
-      infer(os.Args[2:])
+      err = infer(os.Args[2:])
+    case strings.HasPrefix("why", act):
+      err = why(os.Args[2:])
+    case strings.HasPrefix("status", act):
+      err = status(os.Args[2:])
+    case strings.HasPrefix("outdated", act):
+      err = outdated(os.Args[2:])
+    case strings.HasPrefix("verify", act):
+      err = verify(os.Args[2:])
+    case strings.HasPrefix("remove", act):
+      err = remove(os.Args[2:])
     default:
       fmt.Printf("error: no such command %q\n", act)
       usage()
-      return
+      os.Exit(exitUsage)
+  }
+  
+  if err != nil {
+    reportError(err)
+    os.Exit(exitCode(err))
   }
   
 }
@@ -95,31 +137,83 @@ func main() {
 /**
  * Infer imports
  */
-func infer(args []string) {
+func infer(args []string) error {
   
-  fSource   := cmdline.String ("source",  os.Getenv("PWD"),   "The directory in which package sources are found.")
-  fListPath := cmdline.Bool   ("paths",   false,              "List paths instead of packages.")
+  fSource   := cmdline.String ("source", os.Getenv("PWD"),  "The directory in which package sources are found.")
+  fListPath := cmdline.Bool   ("paths",  false,             "List paths instead of packages.")
+  fFormat   := cmdline.String ("format", "list",            "The output format: 'list' to list imported packages, or 'dot' or 'json' to produce the import graph.")
+  fRepos    := cmdline.Bool   ("repos",  false,             "In 'dot' format, graph the imports between repositories rather than packages.")
   cmdline.Parse(args)
   
+  var graph *importGraph
+  switch *fFormat {
+    case "list":
+    case "dot", "json":
+      if optJSON {
+        return usageError(fmt.Errorf("-json cannot be combined with -format %v", *fFormat))
+      }
+      graph = newImportGraph()
+    default:
+      return usageError(fmt.Errorf("invalid format: %v", *fFormat))
+  }
+  
+  build, err := parseBuildContext(optBuildOS, optBuildArch, optBuildTags)
+  if err != nil {
+    return usageError(err)
+  }
+  goVersion, err := parseGoVersion(optGoVersion)
+  if err != nil {
+    return usageError(err)
+  }
+  
   opts := inferOptions{
     ExcludeFilter: looksPrivateSourceFilter,
+    Build: build,
+    Packages: optPackageDeps,
+    GoVersion: goVersion,
+    Local: optLocalPackages,
   }
-  if *fListPath {
+  if graph != nil {
+    opts.Graph = graph
+  }else if optJSON {
+    // packages are reported as events instead
+  }else if *fListPath {
     opts.ListPaths = true
   }else{
     opts.ListPackages = true
   }
   
+  err = loadDiscoveryCache()
+  if err != nil {
+    return err
+  }
+  defer func() {
+    if err := saveDiscoveryCache(); err != nil {
+      reportError(err)
+    }
+  }()
+  
   noted := make(map[string]struct{})
   listed := make(map[string]struct{})
   for _, e := range cmdline.Args() {
     err := inferInc(noted, listed, *fSource, []string{e}, nil, opts)
     if err != nil {
-      fmt.Printf("%v: %v\n", cmd, err)
-      return
+      return err
+    }
+  }
+  
+  if graph != nil {
+    if *fFormat == "dot" {
+      err = graph.WriteDOT(os.Stdout, *fRepos)
+    }else{
+      err = graph.WriteJSON(os.Stdout)
+    }
+    if err != nil {
+      return err
     }
   }
   
+  return nil
  }
 
 /**
@@ -129,25 +223,42 @@ func inferInc(noted, listed map[string]struct{}, srcbase string, pkgs []string,
   for _, e := range pkgs {
     
     // find our repo
-    dir, info, _, err := packageRepo(e, remap, srcbase)
+    isPath := false
+    dir, info, repo, err := packageRepo(e, remap, nil, srcbase)
     if err == errRepoRootNotFound {
-      dir, srcbase = e, e
+      dir, srcbase, isPath = e, e, true
       info, err = os.Stat(dir)
       if err != nil {
         if os.IsNotExist(err) {
-          return fmt.Errorf("no such package or path: %v\n", e)
+          return resolutionError(fmt.Errorf("no such package or path: %v\n", e))
         }else{
           return fmt.Errorf("could not read directory: %v\n", err)
         }
       }
     }else if err != nil {
-      return fmt.Errorf("%v: %v", e, err)
+      return resolutionError(fmt.Errorf("%v: %v", e, err))
     }
+    
+    // note the repo this package belongs to; a path is its own repo
+    root := e
+    if !isPath {
+      root = repo.root
+    }
+    if opts.Graph != nil {
+      opts.Graph.AddPackage(e, root)
+    }
+    
     if info == nil {
       continue
     }
     
-    // make sure we haven't already visited this repo
+    // when following individual packages we only consider the package itself,
+    // otherwise we consider its entire repo
+    if opts.Packages && !isPath {
+      dir = path.Join(srcbase, e)
+    }
+    
+    // make sure we haven't already visited this repo (or package)
     if _, ok := noted[dir]; ok {
       continue
     }else{
@@ -160,17 +271,43 @@ func inferInc(noted, listed map[string]struct{}, srcbase string, pkgs []string,
       return err
     }
     
-    // list them
-    for _, d := range deps {
-      if _, ok := listed[d]; ok {
-        continue
+    // record the edges between packages, which we need to consider individually
+    // if we've considered an entire repo
+    if opts.Graph != nil {
+      if opts.Packages && !isPath {
+        for _, d := range deps {
+          opts.Graph.AddImport(e, d)
+        }
+      }else{
+        err = opts.Graph.AddDir(dir, root, root, opts)
+        if err != nil {
+          return err
+        }
       }
-      if opts.ListPaths {
-        fmt.Printf("%v\n", path.Join(srcbase, d))
-      }else if opts.ListPackages {
-        fmt.Printf("%v\n", d)
+    }
+    
+    // report them as an event, or list them
+    if optJSON {
+      var ev *event
+      if isPath {
+        ev = &event{Action: actionScanned, Package: e, Output: dir}
+      }else{
+        ev = newRepoEvent(actionScanned, e, dir, repo)
+      }
+      ev.Imports = deps
+      emit(ev)
+    }else{
+      for _, d := range deps {
+        if _, ok := listed[d]; ok {
+          continue
+        }
+        if opts.ListPaths {
+          fmt.Printf("%v\n", path.Join(srcbase, d))
+        }else if opts.ListPackages {
+          fmt.Printf("%v\n", d)
+        }
+        listed[d] = struct{}{}
       }
-      listed[d] = struct{}{}
     }
     
     // recurse to dependencies
@@ -186,11 +323,21 @@ func inferInc(noted, listed map[string]struct{}, srcbase string, pkgs []string,
 /**
  * Fetch packages
  */
-func fetch(args []string) {
+func fetch(args []string) error {
   
-  fOutput   := cmdline.String ("output",    os.Getenv("PWD"),  "The directory in which to write packages.")
-  fUpdate   := cmdline.Bool   ("update",    false,             "Update packages if they have already been downloaded. When combined with -s packages are remoted and re-fetched.")
-  fKeepVCS  := cmdline.Bool   ("keep-vcs",  false,             "Retain VCS files from downloaded packages (.git, .svn, .hg, .bzr).")
+  fOutput        := cmdline.String ("output",         os.Getenv("PWD"),  "The directory in which to write packages.")
+  fUpdate        := cmdline.Bool   ("update",         false,             "Update packages if they have already been downloaded. When combined with -s packages are remoted and re-fetched.")
+  fKeepVCS       := cmdline.Bool   ("keep-vcs",       false,             "Retain VCS files from downloaded packages (.git, .svn, .hg, .bzr).")
+  fLockfile      := cmdline.String ("lockfile",       defaultLockfile,   "The lockfile in which to record the revision of every fetched repository, relative to the output directory. Pass an empty value to disable.")
+  fLocked        := cmdline.Bool   ("locked",         false,             "Check out the revisions recorded in the lockfile instead of the latest upstream revisions. If no packages are provided, every repository in the lockfile is fetched.")
+  fJobs          := cmdline.Int    ("jobs",           1,                 "The number of repositories to fetch concurrently.")
+  fPrune         := cmdline.Bool   ("prune-unused",   false,             "Delete the packages in fetched repositories which are not reachable from the requested packages.")
+  fStripTests    := cmdline.Bool   ("strip-tests",    false,             "Delete Go test files (*_test.go) from downloaded packages.")
+  fStripTestdata := cmdline.Bool   ("strip-testdata", false,             "Delete testdata directories from downloaded packages.")
+  fStripExamples := cmdline.Bool   ("strip-examples", false,             "Delete example directories and example test files from downloaded packages.")
+  fStripNonGo    := cmdline.Bool   ("strip-non-go",   false,             "Delete files which are not needed to build downloaded packages. License files are retained.")
+  fKeepGoing     := cmdline.Bool   ("keep-going",     false,             "Continue fetching the rest of the packages when some cannot be fetched, and summarize the failures at the end.")
+  fDryRun        := cmdline.Bool   ("dry-run",        false,             "Report which repositories would be created, updated, kept or removed, without changing the output directory or the lockfile.")
   cmdline.Parse(args)
   
   mapPackages := make(map[string]string)
@@ -198,90 +345,479 @@ func fetch(args []string) {
     for _, e := range optMapPackages {
       p := strings.Split(e, "=")
       if len(p) != 2 {
-        fmt.Printf("%v: invalid package mapping: %v", cmd, e)
-        return
+        return usageError(fmt.Errorf("invalid package mapping: %v", e))
       }
       mapPackages[p[0]] = p[1]
     }
   }
   
+  build, err := parseBuildContext(optBuildOS, optBuildArch, optBuildTags)
+  if err != nil {
+    return usageError(err)
+  }
+  goVersion, err := parseGoVersion(optGoVersion)
+  if err != nil {
+    return usageError(err)
+  }
+  
   opts := fetchOptions{
     AllowUpdate: *fUpdate,
     StripVCS: !*fKeepVCS,
+    Locked: *fLocked,
+    KeepGoing: *fKeepGoing,
+    DryRun: *fDryRun,
+    Jobs: *fJobs,
+    Strip: stripFilters(*fStripTests, *fStripTestdata, *fStripExamples, *fStripNonGo),
     InferOptions: inferOptions{
       ExcludeFilter: looksPrivateSourceFilter,
+      Build: build,
+      Packages: optPackageDeps,
+      GoVersion: goVersion,
+      Local: optLocalPackages,
     },
   }
   
-  noted := make(map[string]struct{})
-  err := fetchInc(noted, cmdline.Args(), mapPackages, *fOutput, opts)
+  var lock *lockfile
+  lockPath := lockfilePath(*fOutput, *fLockfile)
+  if lockPath != "" {
+    var err error
+    lock, err = readLockfile(lockPath)
+    if err != nil {
+      return err
+    }
+  }
+  
+  pkgs := make([]string, 0)
+  opts.Versions = make(map[string]string)
+  for _, e := range cmdline.Args() {
+    p, v := splitVersion(e)
+    if isVersionQuery(v) {
+      if _, err := parseVersionQuery(v); err != nil {
+        return usageError(err)
+      }
+    }
+    if c, ok := opts.Versions[p]; ok && c != v {
+      return usageError(fmt.Errorf("conflicting versions requested for %v: %v and %v", p, c, v))
+    }
+    if v != "" {
+      opts.Versions[p] = v
+    }
+    pkgs = append(pkgs, p)
+  }
+  
+  if *fLocked {
+    if lock == nil {
+      return usageError(fmt.Errorf("cannot fetch locked revisions without a lockfile"))
+    }
+    if len(pkgs) < 1 {
+      pkgs = lock.Roots()
+    }
+  }
+  
+  err = loadDiscoveryCache()
   if err != nil {
-    fmt.Printf("%v: %v\n", cmd, err)
-    return
+    return err
   }
   
+  state := newFetchState(lock)
+  if *fDryRun {
+    state.Shadow, err = ioutil.TempDir("", "gofetch-plan")
+    if err != nil {
+      return err
+    }
+    defer os.RemoveAll(state.Shadow)
+  }
+  err = fetchInc(state, pkgs, mapPackages, *fOutput, opts)
+  os.Remove(path.Join(*fOutput, stagingDir)) // if it's empty, as it should be
+  if serr := saveDiscoveryCache(); serr != nil {
+    reportError(serr)
+  }
+  
+  // repositories are only recorded once they've been moved into place, so what
+  // the lockfile records is what's in the output directory even if we fail
+  writeLock := func() error {
+    if lock == nil || *fDryRun {
+      return nil
+    }
+    return lock.Write(lockPath)
+  }
+  
+  // if only some packages failed, the rest have still been fetched and should
+  // be recorded before we report the failures; anything else is fatal
+  failures, partial := err.(fetchFailures)
+  if err != nil && !partial {
+    if werr := writeLock(); werr != nil {
+      reportError(werr)
+    }
+    return err
+  }
+  
+  // pruning might remove what we would have reached via packages that failed
+  if *fPrune && partial {
+    notice("%v: not pruning unused packages, since some could not be fetched", cmd)
+  }else if *fPrune {
+    err = pruneUnused(state, pkgs, *fOutput, opts.InferOptions)
+    if err != nil {
+      if werr := writeLock(); werr != nil {
+        reportError(werr)
+      }
+      return err
+    }
+  }
+  
+  if lock != nil && len(cmdline.Args()) > 0 {
+    lock.AddPackages(pkgs...) // not the roots we fall back to when locked
+  }
+  err = writeLock()
+  if err != nil {
+    return err
+  }
+  
+  if partial {
+    return failures
+  }
+  
+  return nil
 }
 
 /**
- * Process packages
+ * Process packages. The dependency graph is fetched one level at a time; the
+ * repositories within a level are fetched concurrently by up to opts.Jobs
+ * workers. Output is produced in the order packages appear in each level,
+ * regardless of the order in which they complete.
  */
-func fetchInc(noted map[string]struct{}, pkgs []string, remap map[string]string, outbase string, opts fetchOptions) error {
-  for _, e := range pkgs {
+func fetchInc(state *fetchState, pkgs []string, remap map[string]string, outbase string, opts fetchOptions) error {
+  var failures fetchFailures
+  for len(pkgs) > 0 {
     
-    // find our repo
-    dir, info, repo, err := packageRepo(e, remap, outbase)
-    if err != nil {
-      return err
+    type result struct {
+      ev      *event
+      deps    []string
+      err     error
+      ready   bool
     }
     
-    // make sure we haven't already visited this repo
-    if _, ok := noted[dir]; ok {
-      continue
-    }else{
-      noted[dir] = struct{}{}
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    results := make([]result, len(pkgs))
+    next, printed, failed := 0, 0, false
+    
+    // print results in order, as far as we can; mu must be held
+    flush := func() {
+      for ; printed < len(results) && results[printed].ready; printed++ {
+        if ev := results[printed].ev; ev != nil {
+          emit(ev)
+        }
+      }
     }
     
-    if repo.root != e {
-      fmt.Printf(" + %v (%v)\n", e, repo.root)
-    }else{
-      fmt.Printf(" + %v\n", e)
+    jobs := opts.Jobs
+    if jobs < 1 {
+      jobs = 1
+    }
+    if jobs > len(pkgs) {
+      jobs = len(pkgs)
     }
     
-    // if we're stripping VCS files we cannot update, we must delete and re-fecth
-    if info != nil && opts.AllowUpdate && opts.StripVCS {
-      err = os.RemoveAll(dir)
-      if err != nil {
-        return err
+    for i := 0; i < jobs; i++ {
+      wg.Add(1)
+      go func() {
+        defer wg.Done()
+        for {
+          
+          mu.Lock()
+          if failed || next >= len(pkgs) {
+            mu.Unlock()
+            return
+          }
+          n := next
+          next++
+          mu.Unlock()
+          
+          // text is reported as soon as a repo is resolved, but JSON (and a plan)
+          // is reported once we know how things turned out
+          var ev *event
+          announce := func(e *event) {
+            ev = e
+            if !optJSON && !opts.DryRun {
+              c := *e
+              mu.Lock()
+              results[n].ev, results[n].ready = &c, true
+              flush()
+              mu.Unlock()
+            }
+          }
+          
+          deps, err := fetchRepo(state, pkgs[n], remap, outbase, opts, announce)
+          if (optJSON || opts.DryRun) && err != nil {
+            if ev == nil {
+              ev = &event{Package: pkgs[n]}
+            }
+            ev.Action, ev.Error = actionFailed, strings.TrimSpace(err.Error())
+          }
+          
+          mu.Lock()
+          if optJSON || opts.DryRun {
+            results[n].ev = ev
+          }
+          results[n].deps, results[n].err, results[n].ready = deps, err, true
+          if _, ok := err.(*offlineError); err != nil && !ok && !opts.KeepGoing {
+            failed = true
+          }
+          flush()
+          mu.Unlock()
+          
+        }
+      }()
+    }
+    
+    wg.Wait()
+    
+    // collect the next level of the graph; packages we can't fetch in offline
+    // mode, or at all when we're keeping going, are noted and the rest continue
+    level := pkgs
+    pkgs = nil
+    seen := make(map[string]struct{})
+    for i, e := range results {
+      if e.err != nil {
+        if _, ok := e.err.(*offlineError); !ok && !opts.KeepGoing {
+          return e.err
+        }
+        failures = append(failures, packageFailure{level[i], e.err})
+        continue
+      }
+      for _, d := range e.deps {
+        if _, ok := seen[d]; !ok {
+          pkgs = append(pkgs, d)
+          seen[d] = struct{}{}
+        }
       }
-      info = nil
     }
     
-    // if we're not only listing packages, actually fetch them
-    err = fetchPackage(dir, info, repo, opts)
+  }
+  
+  // report every package we couldn't fetch at once
+  if len(failures) > 0 {
+    return failures
+  }
+  
+  return nil
+}
+
+/**
+ * Fetch the repository for a single package and return its dependencies. Once
+ * the repository has been resolved, a description of it is provided to the
+ * announce function. If the repository has already been claimed nothing is
+ * done, unless we're following individual packages, in which case we wait for
+ * the repository to be fetched and then return the package's dependencies.
+ */
+func fetchRepo(state *fetchState, e string, remap map[string]string, outbase string, opts fetchOptions, announce func(*event)) ([]string, error) {
+  
+  // make sure we haven't already visited this package
+  if opts.InferOptions.Packages && !state.Packages.Add(e) {
+    return nil, nil
+  }
+  
+  // find our repo, preferring the locked one if we're fetching locked revisions
+  // or we cannot discover it because we're offline
+  var locked *lockfile
+  if opts.Locked || optOffline {
+    locked = state.Lock
+  }
+  dir, info, repo, err := packageRepo(e, remap, locked, outbase)
+  if err == errRepoRootNotFound && optOffline {
+    return nil, &offlineError{e, "could not resolve repository from the cache"}
+  }else if err != nil {
+    return nil, resolutionError(err)
+  }
+  
+  // make sure we haven't already visited this repo
+  c, first := state.Repos.Claim(dir)
+  if first {
+    err = fetchRepoSources(state, e, dir, outbase, info, repo, opts, announce)
+    c.Finish(err)
+    if err != nil {
+      return nil, err
+    }
+  }else if !opts.InferOptions.Packages {
+    return nil, nil
+  }else if c.Wait() != nil {
+    return nil, nil // whoever claimed the repo reports the error
+  }
+  
+  // infer dependencies, either of the package or of the entire repo
+  if opts.InferOptions.Packages {
+    return packageDeps(state.SourcePath(outbase, e), opts.InferOptions)
+  }else{
+    return packageDeps(state.SourcePath(outbase, repo.root), opts.InferOptions)
+  }
+}
+
+/**
+ * Fetch the sources of a repository into the provided directory. Fresh copies
+ * of a repository are staged elsewhere in the output directory and are only
+ * moved into place once they have been fetched, stripped and their dependencies
+ * inferred; if anything fails, whatever was there before is left alone.
+ */
+func fetchRepoSources(state *fetchState, e, dir, outbase string, info os.FileInfo, repo *repoRoot, opts fetchOptions, announce func(*event)) error {
+  lock := state.Lock
+  version, err := opts.Version(repo.root)
+  if err != nil {
+    return err
+  }
+  
+  // a repo pinned to a different version than we have must be updated
+  ropts := opts
+  if info != nil && version != "" && (lock == nil || lock.Get(repo.root).Version != version) {
+    ropts.AllowUpdate = true
+  }
+  
+  action := actionSkipped
+  if info == nil {
+    action = actionCreated
+  }else if ropts.AllowUpdate {
+    action = actionUpdated
+  }
+  
+  ev := newRepoEvent(action, e, dir, repo)
+  ev.Version = version
+  ev.DryRun = opts.DryRun
+  if action == actionSkipped && lock != nil {
+    ev.Revision = lock.Get(repo.root).Revision
+  }
+  announce(ev)
+  
+  // in a dry run, there's nothing to do for a repo we're leaving alone
+  if opts.DryRun && action == actionSkipped {
+    return nil
+  }
+  
+  // in offline mode, anything we need to fetch must come from the mirror cache
+  if optOffline && (info == nil || ropts.AllowUpdate) && !repo.vcs.hasMirror(repo.repo) {
+    return &offlineError{e, fmt.Sprintf("%v is not in the mirror cache", repo.repo)}
+  }
+  
+  // if we're stripping files (or VCS files have already been stripped) we cannot
+  // update, we must replace the repo with a fresh copy; the same is true in
+  // offline mode, where updates come from the mirror cache
+  target := dir
+  if opts.DryRun {
+    target, info = path.Join(state.Shadow, repo.root), nil // left for the rest of the run to look at
+  }else if info == nil || (ropts.AllowUpdate && (opts.Strips() || optOffline || !hasVCSMetadata(dir, repo.vcs))) {
+    target = stagingPath(outbase, repo.root)
+    err = os.RemoveAll(target)
     if err != nil {
       return err
     }
-    
-    // if we're stripping VCS files, do that
-    if opts.StripVCS {
-      err = prunePath(dir, vcsFileFilter, true)
+    defer os.RemoveAll(target) // whatever's left over
+    info = nil
+  }
+  
+  // if we're not only listing packages, actually fetch them
+  err = fetchPackage(target, info, repo, version, ropts)
+  if err != nil {
+    return err
+  }
+  
+  // if we're fetching locked revisions, check out the pinned one unless an
+  // explicit version was requested
+  if opts.Locked && version == "" {
+    err = syncLockedRepo(lock, target, repo)
+    if err != nil {
+      return err
+    }
+  }
+  
+  // determine the revision we fetched before VCS files are stripped
+  var entry lockEntry
+  if lock != nil || opts.DryRun {
+    entry, err = repoLockEntry(lock, target, repo, version)
+    if err != nil {
+      return err
+    }
+  }
+  
+  // make sure we fetched the repository and tag we locked, and that a fresh copy
+  // of a revision we've fetched before is what we got last time; if not, upstream
+  // has been tampered with (or the repository we resolved isn't the one we think
+  // it is)
+  if (lock != nil || opts.DryRun) && action != actionSkipped {
+    err = checkLockedRepo(lock, entry, target, repo, version)
+    if err != nil {
+      return err
+    }
+    err = checkRepoSum(&entry, target, repo, info == nil)
+    if err != nil {
+      return err
+    }
+  }
+  
+  // if we're stripping VCS or other files, do that; a repo we're leaving alone
+  // keeps the hash it had so local edits are still detected, so it's only
+  // stripped (and then rehashed) if it's as it was when it was hashed
+  rehash := lock != nil && action != actionSkipped && !opts.DryRun
+  if filter := opts.StripFilter(); filter != nil {
+    strip := true
+    if lock != nil && action == actionSkipped && entry.Hash != "" {
+      h, err := treeHash(target)
       if err != nil {
         return err
       }
+      if h == entry.Hash {
+        rehash = true
+      }else{
+        notice("%v: not stripping %v, since it has been modified", cmd, repo.root)
+        strip = false
+      }
     }
-    
-    // infer dependencies
-    deps, err := packageDeps(dir, opts.InferOptions)
+    if strip {
+      err = prunePath(target, filter, true)
+      if err != nil {
+        return err
+      }
+    }
+  }
+  
+  // note the hash of whatever we've fetched, now that it's been stripped
+  if rehash {
+    entry.Hash, err = treeHash(target)
     if err != nil {
       return err
     }
-    
-    // recurse to dependencies
-    err = fetchInc(noted, deps, remap, outbase, opts)
+  }
+  
+  // in a dry run, we only note the revision we would have fetched
+  if opts.DryRun {
+    ev.Revision = entry.Revision
+    return nil
+  }
+  
+  // make sure we can infer the dependencies of a fresh copy and move it into place
+  if target != dir {
+    deps := target
+    if opts.InferOptions.Packages && strings.HasPrefix(e, repo.root+"/") {
+      deps = path.Join(target, e[len(repo.root):])
+    }
+    if isDir(deps) {
+      _, err = packageDeps(deps, opts.InferOptions)
+      if err != nil {
+        return err
+      }
+    }
+    err = replaceDir(target, dir)
     if err != nil {
       return err
     }
-    
   }
+  
+  // and only then record it
+  if lock != nil {
+    lock.Set(repo.root, entry)
+    ev.Revision = entry.Revision
+  }
+  if action != actionSkipped {
+    state.Fetched.Add(repo.root)
+  }
+  
   return nil
 }
@@ -0,0 +1,231 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "os"
+  "fmt"
+  "path"
+  "sort"
+  "strings"
+  "text/tabwriter"
+)
+
+/**
+ * The newest tag available for a vendored repository
+ */
+type repoTags struct {
+  Root      string  `json:"root"`
+  VCS       string  `json:"vcs,omitempty"`
+  Repo      string  `json:"repo,omitempty"`
+  Version   string  `json:"version,omitempty"`   // the version requested when fetching
+  Revision  string  `json:"revision,omitempty"`  // the vendored revision
+  Tag       string  `json:"tag,omitempty"`       // the tag the vendored revision is at, if any
+  Newest    string  `json:"newest,omitempty"`    // the newest available tag
+  Outdated  bool    `json:"outdated"`
+  Error     string  `json:"error,omitempty"`
+}
+
+/**
+ * Describe the current version
+ */
+func (t *repoTags) Current() string {
+  switch {
+    case t.Tag != "" && t.Revision != "":
+      return fmt.Sprintf("%v (%v)", t.Tag, shortRevision(t.Revision))
+    case t.Tag != "":
+      return t.Tag
+    case t.Revision != "":
+      return shortRevision(t.Revision)
+    default:
+      return "-"
+  }
+}
+
+/**
+ * Describe the details
+ */
+func (t *repoTags) Details() string {
+  switch {
+    case t.Error != "":
+      return t.Error
+    case t.Outdated:
+      return "newer tag available"
+    case t.Newest == "":
+      return "no release tags"
+    case t.Tag == "":
+      return "not at a tag"
+    default:
+      return ""
+  }
+}
+
+/**
+ * List the newest tags available for vendored repositories
+ */
+func outdated(args []string) error {
+  
+  fOutput    := cmdline.String ("output",     os.Getenv("PWD"),  "The directory in which packages have been fetched.")
+  fLockfile  := cmdline.String ("lockfile",   defaultLockfile,   "The lockfile which records the fetched repositories, relative to the output directory. Pass an empty value to only consider repositories detected in the output directory.")
+  fSameMajor := cmdline.Bool   ("same-major", false,             "Only consider tags with the same major version as the current one.")
+  cmdline.Parse(args)
+  
+  var lock *lockfile
+  if lockPath := lockfilePath(*fOutput, *fLockfile); lockPath != "" {
+    var err error
+    lock, err = readLockfile(lockPath)
+    if err != nil {
+      return err
+    }
+  }
+  
+  err := loadDiscoveryCache()
+  if err != nil {
+    return err
+  }
+  defer func() {
+    if err := saveDiscoveryCache(); err != nil {
+      reportError(err)
+    }
+  }()
+  
+  repos, err := detectRepos(*fOutput, lock)
+  if err != nil {
+    return err
+  }
+  
+  roots := make([]string, 0, len(repos))
+  for k, _ := range repos {
+    roots = append(roots, k)
+  }
+  sort.Strings(roots)
+  
+  var t *tabwriter.Writer
+  if !optJSON {
+    t = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintf(t, "REPOSITORY\tCURRENT\tNEWEST\tDETAILS\n")
+  }
+  
+  for _, e := range roots {
+    tags := repoTagsFor(e, repos[e], lock, *fOutput, *fSameMajor)
+    if optJSON {
+      if err := writeJSON(tags); err != nil {
+        return err
+      }
+    }else{
+      newest := tags.Newest
+      if newest == "" {
+        newest = "-"
+      }
+      fmt.Fprintf(t, "%v\t%v\t%v\t%v\n", tags.Root, tags.Current(), newest, tags.Details())
+    }
+  }
+  
+  if t != nil {
+    return t.Flush()
+  }
+  return nil
+}
+
+/**
+ * Determine the current and newest tags of a vendored repository. If the
+ * repository isn't known from the lockfile or its VCS metadata it is resolved
+ * from its import path, the same way it is when fetching.
+ */
+func repoTagsFor(root string, repo *repoRoot, lock *lockfile, outbase string, sameMajor bool) *repoTags {
+  dir := path.Join(outbase, root)
+  res := &repoTags{Root: root}
+  
+  entry, _ := lock.Lookup(root)
+  res.Version, res.Revision = entry.Version, entry.Revision
+  
+  if repo == nil {
+    var err error
+    _, _, repo, err = packageRepo(root, nil, nil, outbase)
+    if err != nil {
+      res.Error = fmt.Sprintf("could not resolve repository: %v", err)
+      return res
+    }
+  }
+  res.VCS, res.Repo = repo.vcs.cmd, repo.repo
+  
+  if hasVCSMetadata(dir, repo.vcs) {
+    if rev, err := repo.vcs.revision(dir); err == nil {
+      res.Revision = rev
+    }
+  }
+  
+  err := compareTags(res, repo, sameMajor)
+  if err != nil {
+    res.Error = strings.TrimSpace(err.Error())
+  }
+  
+  return res
+}
+
+/**
+ * Determine the tag the vendored revision is at, preferring the version it was
+ * fetched at, and the newest tag available upstream. The repository is only
+ * outdated if it is at a tag and the newest one is a higher version.
+ */
+func compareTags(res *repoTags, repo *repoRoot, sameMajor bool) error {
+  
+  up, err := openUpstream(repo)
+  if err != nil {
+    return err
+  }
+  defer up.Close()
+  
+  tags, err := repo.vcs.releaseTags(up.dir)
+  if err != nil {
+    return fmt.Errorf("could not list tags: %v", err)
+  }
+  
+  if _, ok := parseSemver(res.Version); ok && containsString(tags, res.Version) {
+    res.Tag = res.Version
+  }else if res.Revision != "" {
+    at, err := repo.vcs.revisionTags(up.dir, res.Revision)
+    if err != nil {
+      return fmt.Errorf("could not list tags at %v: %v", res.Revision, err)
+    }
+    res.Tag, _ = selectTag(at, versionQuery{})
+  }
+  
+  q := versionQuery{}
+  if v, ok := parseSemver(res.Tag); ok && sameMajor {
+    q = versionQuery{Min: semver{Major: v.Major, Fields: 3}, Max: semver{Major: v.Major + 1, Fields: 3}, Bounded: true}
+  }
+  
+  res.Newest, _ = selectTag(tags, q)
+  res.Outdated = newerTag(res.Tag, res.Newest)
+  
+  return nil
+}
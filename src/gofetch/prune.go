@@ -0,0 +1,207 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+
+package main
+
+import (
+  "os"
+  "path"
+  "sort"
+  "strings"
+)
+
+/**
+ * Determine the packages that are reachable from the provided packages by
+ * following their imports through the sources under the output directory (or,
+ * in a dry run, what would be there). Imports which are not present are not
+ * followed.
+ */
+func reachablePackages(state *fetchState, pkgs []string, outbase string, opts inferOptions) (map[string]struct{}, error) {
+  reachable := make(map[string]struct{})
+  dir := func(pkg string) string { return state.SourcePath(outbase, pkg) }
+  
+  err := walkImports(pkgs, dir, nil, opts, func(pkg, parent, source string) bool {
+    if isDir(dir(pkg)) {
+      reachable[pkg] = struct{}{}
+    }
+    return true
+  })
+  if err != nil {
+    return nil, err
+  }
+  
+  return reachable, nil
+}
+
+/**
+ * Determine if a directory hierarchy contains any Go packages. Directories which
+ * the go tool ignores (hidden ones, those prefixed with '_' and testdata) are
+ * not considered.
+ */
+func containsGoPackages(dir string) bool {
+  file, err := os.Open(dir)
+  if err != nil {
+    return false
+  }
+  items, err := file.Readdir(0)
+  file.Close()
+  if err != nil {
+    return false
+  }
+  for _, e := range items {
+    name := e.Name()
+    switch {
+      case !e.IsDir() && strings.EqualFold(path.Ext(name), ".go"):
+        return true
+      case !e.IsDir() || name[0] == '.' || name[0] == '_' || name == "testdata":
+        continue
+      case containsGoPackages(path.Join(dir, name)):
+        return true
+    }
+  }
+  return false
+}
+
+/**
+ * Delete the package directories in fetched repositories that are not reachable
+ * from the provided packages. Directories which don't contain any packages are
+ * left alone, since packages which are used may need them. Repositories which
+ * contain no reachable packages at all are deleted entirely and removed from
+ * the lockfile. In a dry run what would be deleted is only reported.
+ */
+func pruneUnused(state *fetchState, pkgs []string, outbase string, opts inferOptions) error {
+  dryRun := state.Shadow != ""
+  
+  reachable, err := reachablePackages(state, pkgs, outbase, opts)
+  if err != nil {
+    return err
+  }
+  
+  // determine if an import path is a reachable package or contains one
+  used := func(p string) bool {
+    if _, ok := reachable[p]; ok {
+      return true
+    }
+    for e, _ := range reachable {
+      if strings.HasPrefix(e, p+"/") {
+        return true
+      }
+    }
+    return false
+  }
+  
+  dirs := state.Repos.Keys()
+  sort.Strings(dirs)
+  
+  for _, dir := range dirs {
+    root := strings.TrimPrefix(dir, path.Clean(outbase)+"/")
+    
+    if !used(root) {
+      emit(&event{Action: actionRemoved, Package: root, Root: root, Output: dir, Reason: "unused", DryRun: dryRun})
+      if dryRun {
+        continue
+      }
+      err = removeAllAndEmptyParents(dir, outbase)
+      if err != nil {
+        return err
+      }
+      if state.Lock != nil {
+        state.Lock.Delete(root)
+      }
+      continue
+    }
+    
+    // a repository we didn't fetch in this run may have local edits, which would
+    // become the baseline if we rehashed it after pruning; it's only pruned if
+    // it's as it was when it was hashed
+    rehash := state.Lock != nil && state.Fetched.Contains(root)
+    if !dryRun && state.Lock != nil && !rehash {
+      if e, ok := state.Lock.Lookup(root); ok && e.Hash != "" {
+        h, err := treeHash(dir)
+        if err != nil {
+          return err
+        }
+        if h != e.Hash {
+          notice("%v: not pruning unused packages in %v, since it has been modified", cmd, root)
+          continue
+        }
+        rehash = true
+      }
+    }
+    
+    src := state.SourcePath(outbase, root)
+    var removed []string
+    err = prunePath(src, func(p string) bool {
+      if !isDir(p) {
+        return false
+      }
+      for _, e := range strings.Split(p[len(src)+1:], "/") {
+        if e == "" || e[0] == '.' || e[0] == '_' || e == "testdata" {
+          return false // leave hidden things, like VCS files, and things which are never packages alone
+        }
+      }
+      pkg := root + p[len(src):]
+      if used(pkg) {
+        return false
+      }
+      if !containsGoPackages(p) {
+        return false // assets, C headers and the like which packages may need
+      }
+      for _, e := range removed {
+        if strings.HasPrefix(pkg, e+"/") {
+          return false // already reported in a dry run
+        }
+      }
+      if optVerbose || optJSON || dryRun {
+        emit(&event{Action: actionRemoved, Package: pkg, Root: root, Output: path.Join(dir, p[len(src):]), Reason: "unused", DryRun: dryRun})
+      }
+      removed = append(removed, pkg)
+      return !dryRun
+    }, true)
+    if err != nil {
+      return err
+    }
+    
+    // the tree has changed, so its hash must be updated
+    if len(removed) > 0 && !dryRun && rehash {
+      if e, ok := state.Lock.Lookup(root); ok {
+        e.Hash, err = treeHash(dir)
+        if err != nil {
+          return err
+        }
+        state.Lock.Set(root, e)
+      }
+    }
+    
+  }
+  
+  return nil
+}
@@ -0,0 +1,126 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "os"
+  "path"
+  "testing"
+  "io/ioutil"
+)
+
+/**
+ * Write a tree of files under a directory
+ */
+func writeTestTree(t *testing.T, base string, files map[string]string) {
+  for k, v := range files {
+    p := path.Join(base, k)
+    err := os.MkdirAll(path.Dir(p), 0755)
+    if err != nil {
+      t.Fatal(err)
+    }
+    err = ioutil.WriteFile(p, []byte(v), 0644)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+}
+
+/**
+ * Test pruning unreachable packages from a fixture tree
+ */
+func TestPruneUnused(t *testing.T) {
+  
+  base, err := ioutil.TempDir("", "gofetch-test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(base)
+  
+  writeTestTree(t, base, map[string]string{
+    "x.com/a/one/one.go":             "package one\nimport _ \"x.com/b/two\"\nimport _ \"x.com/d/four\"\n",
+    "x.com/a/one/unused/unused.go":   "package unused\nimport _ \"x.com/c/three\"\n",
+    "x.com/a/one/cmd/tool/main.go":   "package main\n",
+    "x.com/a/one/static/style.css":   "body {}\n",
+    "x.com/a/one/include/one.h":      "int one;\n",
+    "x.com/a/one/testdata/src/x.go":  "package x\n",
+    "x.com/b/two/two.go":             "package two\n",
+    "x.com/b/two/extra/extra.go":     "package extra\n",
+    "x.com/c/three/three.go":         "package three\n",
+    "x.com/d/four/four.go":           "package four\n",
+    "x.com/d/four/extra/extra.go":    "package extra\n",
+  })
+  
+  lock := newLockfile()
+  state := newFetchState(lock)
+  for _, e := range []string{"x.com/a/one", "x.com/b/two", "x.com/c/three", "x.com/d/four"} {
+    lock.Set(e, lockEntry{VCS: "git", Repo: "https://"+e, Hash: "stale"})
+    state.Repos.Claim(path.Join(base, e))
+  }
+  state.Fetched.Add("x.com/a/one") // the others were left alone
+  
+  // x.com/b/two is as it was when it was hashed, x.com/d/four has been modified
+  clean, err := treeHash(path.Join(base, "x.com/b/two"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  lock.Set("x.com/b/two", lockEntry{VCS: "git", Repo: "https://x.com/b/two", Hash: clean})
+  
+  err = pruneUnused(state, []string{"x.com/a/one"}, base, inferOptions{GoVersion: -1})
+  if err != nil {
+    t.Fatal(err)
+  }
+  
+  for _, e := range []string{"x.com/a/one/one.go", "x.com/a/one/static/style.css", "x.com/a/one/include/one.h", "x.com/a/one/testdata/src/x.go", "x.com/b/two/two.go", "x.com/d/four/extra/extra.go"} {
+    if _, err := os.Stat(path.Join(base, e)); err != nil {
+      t.Errorf("expected %v to be retained: %v", e, err)
+    }
+  }
+  for _, e := range []string{"x.com/a/one/unused", "x.com/a/one/cmd", "x.com/b/two/extra", "x.com/c"} {
+    if _, err := os.Stat(path.Join(base, e)); !os.IsNotExist(err) {
+      t.Errorf("expected %v to be pruned", e)
+    }
+  }
+  
+  if _, ok := lock.Lookup("x.com/c/three"); ok {
+    t.Errorf("expected x.com/c/three to be removed from the lockfile")
+  }
+  if h, err := treeHash(path.Join(base, "x.com/a/one")); err != nil || lock.Get("x.com/a/one").Hash != h {
+    t.Errorf("expected the hash of x.com/a/one to be updated")
+  }
+  if h, err := treeHash(path.Join(base, "x.com/b/two")); err != nil || lock.Get("x.com/b/two").Hash != h {
+    t.Errorf("expected the hash of x.com/b/two, which wasn't fetched but wasn't modified, to be updated")
+  }
+  if h := lock.Get("x.com/d/four").Hash; h != "stale" {
+    t.Errorf("expected the hash of x.com/d/four, which was modified, to be left alone; got %v", h)
+  }
+  
+}
@@ -0,0 +1,230 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "os"
+  "fmt"
+  "path"
+)
+
+/**
+ * Remove vendored repositories and report, or also remove, the repositories
+ * which are no longer imported by anything as a result
+ */
+func remove(args []string) error {
+  
+  var fFrom stringList
+  fOutput   := cmdline.String ("output",   os.Getenv("PWD"),  "The directory in which packages have been fetched.")
+  fLockfile := cmdline.String ("lockfile", defaultLockfile,   "The lockfile which records the fetched repositories, relative to the output directory.")
+  fOrphans  := cmdline.Bool   ("orphans",  false,             "Also remove repositories which are no longer imported by anything.")
+  fForce    := cmdline.Bool   ("force",    false,             "Remove repositories even if they are still imported.")
+  cmdline.Var (&fFrom, "from", "A package or path from which to search for imports (may be repeated). By default the packages requested when fetching are used.")
+  cmdline.Parse(args)
+  
+  if len(cmdline.Args()) < 1 {
+    return usageError(fmt.Errorf("usage: %v remove [-options] package1 [package2 ...]", cmd))
+  }
+  
+  build, err := parseBuildContext(optBuildOS, optBuildArch, optBuildTags)
+  if err != nil {
+    return usageError(err)
+  }
+  goVersion, err := parseGoVersion(optGoVersion)
+  if err != nil {
+    return usageError(err)
+  }
+  
+  opts := inferOptions{
+    ExcludeFilter: looksPrivateSourceFilter,
+    Build: build,
+    Packages: true,
+    GoVersion: goVersion,
+    Local: optLocalPackages,
+  }
+  
+  lockPath := lockfilePath(*fOutput, *fLockfile)
+  if lockPath == "" {
+    return usageError(fmt.Errorf("a lockfile is required to remove repositories"))
+  }
+  lock, err := readLockfile(lockPath)
+  if err != nil {
+    return err
+  }
+  
+  err = removePackages(lock, cmdline.Args(), fFrom, *fOutput, *fForce, *fOrphans, opts)
+  if err != nil {
+    return err
+  }
+  
+  return lock.Write(lockPath)
+}
+
+/**
+ * Remove the repositories containing the provided packages and report, or also
+ * remove, the repositories which are no longer imported by anything as a result.
+ * Imports are followed from the provided packages or paths or, if there are
+ * none, from the requested packages which remain. If no packages remain at all
+ * nothing is imported, so every other repository is orphaned.
+ */
+func removePackages(lock *lockfile, pkgs, from []string, outbase string, force, orphaned bool, opts inferOptions) error {
+  
+  // find the repositories to remove before we change anything
+  var removed []*repoRoot
+  for _, e := range pkgs {
+    repo, ok := lock.RepoRoot(e)
+    if !ok {
+      return fmt.Errorf("%v is not in a fetched repository", e)
+    }
+    removed = append(removed, repo)
+  }
+  
+  // the removed repositories' packages are no longer requested
+  for _, e := range removed {
+    lock.RemovePackages(e.root)
+  }
+  
+  roots := from
+  if len(roots) < 1 {
+    roots = lock.RequestedPackages()
+  }
+  
+  // find what's still referenced before we change anything; unless we're following
+  // individual packages, every package in a fetched repository contributes imports
+  repos := lock
+  if optPackageDeps {
+    repos = nil
+  }
+  refs, err := referencedRepos(roots, outbase, lock, repos, opts)
+  if err != nil {
+    return err
+  }
+  
+  // something still importing a repository we're removing would fetch it again,
+  // so we refuse unless forced
+  var imported int
+  for _, e := range removed {
+    if by, ok := refs[e.root]; ok && by != "" {
+      notice("%v: %v is still imported by %v", cmd, e.root, by)
+      imported++
+    }else if ok {
+      notice("%v: %v contains a package being searched from", cmd, e.root)
+      imported++
+    }
+  }
+  if imported > 0 && !force {
+    return fmt.Errorf("%d repository(s) are still imported; provide -force to remove them anyway", imported)
+  }
+  
+  for _, e := range removed {
+    if _, ok := lock.Lookup(e.root); !ok {
+      continue // already removed
+    }
+    err = removeRepo(lock, e.root, outbase, "requested", false)
+    if err != nil {
+      return err
+    }
+  }
+  
+  // a repository is orphaned if nothing reached it, including through those
+  // which were removed but are still imported
+  var orphans []string
+  for _, e := range lock.Roots() {
+    if _, ok := refs[e]; !ok {
+      orphans = append(orphans, e)
+    }
+  }
+  for _, e := range orphans {
+    err = removeRepo(lock, e, outbase, "orphaned", !orphaned)
+    if err != nil {
+      return err
+    }
+  }
+  if len(orphans) > 0 && !orphaned {
+    notice("%v: %d repository(s) are no longer imported; provide -orphans to remove them", cmd, len(orphans))
+  }
+  
+  return nil
+}
+
+/**
+ * Remove a vendored repository and its lockfile entry. If only reporting, the
+ * removal is described as it would be in a dry run and nothing is changed.
+ */
+func removeRepo(lock *lockfile, root, outbase, reason string, report bool) error {
+  dir := path.Join(outbase, root)
+  
+  ev := newRepoEvent(actionRemoved, root, dir, nil)
+  e := lock.Get(root)
+  ev.Root, ev.VCS, ev.Repo, ev.Revision = root, e.VCS, e.Repo, e.Revision
+  ev.Reason, ev.DryRun = reason, report
+  emit(ev)
+  
+  if report {
+    return nil
+  }
+  
+  err := removeAllAndEmptyParents(dir, outbase)
+  if err != nil {
+    return err
+  }
+  
+  lock.Delete(root)
+  return nil
+}
+
+/**
+ * Determine the locked repositories which are reachable from the provided
+ * packages by following their imports through the sources under the source
+ * directory, using the same scan as fetching. Roots may also be paths to
+ * directories which are not under the source directory. If repositories are
+ * provided, the packages in the same repository as a package are also followed.
+ * The result maps the root of each repository to a package which imports it, or
+ * to nothing if it contains one of the roots.
+ */
+func referencedRepos(roots []string, srcbase string, lock, repos *lockfile, opts inferOptions) (map[string]string, error) {
+  refs := make(map[string]string)
+  dir := func(pkg string) string { return path.Join(srcbase, pkg) }
+  
+  err := walkImports(roots, dir, repos, opts, func(pkg, parent, source string) bool {
+    if repo, ok := lock.RepoRoot(pkg); ok {
+      if _, ok := refs[repo.root]; !ok {
+        refs[repo.root] = parent
+      }
+    }
+    return true
+  })
+  if err != nil {
+    return nil, err
+  }
+  
+  return refs, nil
+}
@@ -0,0 +1,163 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+
+package main
+
+import (
+  "os"
+  "path"
+  "reflect"
+  "testing"
+  "io/ioutil"
+)
+
+/**
+ * Test finding the repositories referenced from packages in a fixture tree
+ */
+func TestReferencedRepos(t *testing.T) {
+  
+  base, err := ioutil.TempDir("", "gofetch-test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(base)
+  
+  srcbase := path.Join(base, "src")
+  writeTestTree(t, srcbase, map[string]string{
+    "x.com/a/one/one.go":       "package one\nimport _ \"x.com/b/two\"\n",
+    "x.com/a/one/sub/sub.go":   "package sub\nimport _ \"x.com/c/three\"\n",
+    "x.com/b/two/two.go":       "package two\nimport _ \"fmt\"\n",
+    "x.com/c/three/three.go":   "package three\n",
+    "x.com/d/four/four.go":     "package four\nimport _ \"x.com/a/one\"\n",
+  })
+  
+  project := path.Join(base, "project")
+  writeTestTree(t, project, map[string]string{
+    "main.go": "package main\nimport _ \"x.com/d/four\"\n",
+  })
+  
+  lock := newLockfile()
+  for _, e := range []string{"x.com/a/one", "x.com/b/two", "x.com/c/three", "x.com/d/four", "x.com/e/five"} {
+    lock.Set(e, lockEntry{VCS: "git", Repo: "https://"+e})
+  }
+  
+  tests := []struct {
+    Roots   []string
+    Repos   *lockfile // follow every package in a repository
+    Expect  map[string]string
+  }{
+    {
+      []string{"x.com/a/one"}, nil,
+      map[string]string{"x.com/a/one": "", "x.com/b/two": "x.com/a/one"},
+    },
+    {
+      []string{"x.com/a/one"}, lock,
+      map[string]string{"x.com/a/one": "", "x.com/b/two": "x.com/a/one", "x.com/c/three": "x.com/a/one/sub"},
+    },
+    {
+      []string{"x.com/a/one/sub", "x.com/b/two"}, nil,
+      map[string]string{"x.com/a/one": "", "x.com/b/two": "", "x.com/c/three": "x.com/a/one/sub"},
+    },
+    {
+      []string{project}, nil,
+      map[string]string{"x.com/d/four": project, "x.com/a/one": "x.com/d/four", "x.com/b/two": "x.com/a/one"},
+    },
+    {
+      []string{"x.com/e/five"}, lock, // not fetched, so nothing to follow
+      map[string]string{"x.com/e/five": ""},
+    },
+  }
+  
+  for _, e := range tests {
+    refs, err := referencedRepos(e.Roots, srcbase, lock, e.Repos, inferOptions{Packages: true, GoVersion: -1})
+    if err != nil {
+      t.Fatal(err)
+    }
+    if !reflect.DeepEqual(refs, e.Expect) {
+      t.Errorf("referencedRepos(%v) = %v; expected %v", e.Roots, refs, e.Expect)
+    }
+  }
+}
+
+/**
+ * Test removing the last requested package, which leaves nothing importing the
+ * other repositories
+ */
+func TestRemoveLastPackage(t *testing.T) {
+  
+  for _, orphans := range []bool{false, true} {
+    
+    base, err := ioutil.TempDir("", "gofetch-test")
+    if err != nil {
+      t.Fatal(err)
+    }
+    defer os.RemoveAll(base)
+    
+    writeTestTree(t, base, map[string]string{
+      "x.com/a/one/one.go":       "package one\nimport _ \"x.com/b/two\"\n",
+      "x.com/b/two/two.go":       "package two\nimport _ \"x.com/c/three\"\n",
+      "x.com/c/three/three.go":   "package three\n",
+    })
+    
+    lock := newLockfile()
+    for _, e := range []string{"x.com/a/one", "x.com/b/two", "x.com/c/three"} {
+      lock.Set(e, lockEntry{VCS: "git", Repo: "https://"+e})
+    }
+    lock.AddPackages("x.com/a/one")
+    
+    err = removePackages(lock, []string{"x.com/a/one"}, nil, base, false, orphans, inferOptions{Packages: true, GoVersion: -1})
+    if err != nil {
+      t.Fatal(err)
+    }
+    
+    if _, ok := lock.Lookup("x.com/a/one"); ok {
+      t.Errorf("expected x.com/a/one to be removed from the lockfile")
+    }
+    if _, err := os.Stat(path.Join(base, "x.com/a")); !os.IsNotExist(err) {
+      t.Errorf("expected x.com/a/one to be removed")
+    }
+    if p := lock.RequestedPackages(); len(p) > 0 {
+      t.Errorf("expected no requested packages; got %v", p)
+    }
+    
+    // the others are orphaned; they're only removed with -orphans
+    for _, e := range []string{"x.com/b/two", "x.com/c/three"} {
+      _, locked := lock.Lookup(e)
+      _, err := os.Stat(path.Join(base, e))
+      if orphans && (locked || !os.IsNotExist(err)) {
+        t.Errorf("expected orphaned %v to be removed", e)
+      }else if !orphans && (!locked || err != nil) {
+        t.Errorf("expected orphaned %v to be reported but retained", e)
+      }
+    }
+    
+  }
+}
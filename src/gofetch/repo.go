@@ -34,6 +34,8 @@ import (
   "os"
   "fmt"
   "path"
+  "sync"
+  "gofetch/singleflight"
 )
 
 var errRepoRootNotFound = fmt.Errorf("could not find repo root")
@@ -44,12 +46,17 @@ type repoInfo struct {
   Repo    *repoRoot
 }
 
-var repoCache = make(map[string]repoInfo)
+var repoGroup singleflight.Group
+var (
+  repoCacheMu sync.Mutex
+  repoCache   = make(map[string]repoInfo)
+)
 
 /**
- * Fetch a package
+ * Fetch a package. If a lockfile is provided, repositories it records are used
+ * in preference to discovering them.
  */
-func packageRepo(pkg string, remap map[string]string, base string) (string, os.FileInfo, *repoRoot, error) {
+func packageRepo(pkg string, remap map[string]string, lock *lockfile, base string) (string, os.FileInfo, *repoRoot, error) {
   
   if remap != nil {
     if v, ok := remap[pkg]; ok {
@@ -57,25 +64,57 @@ func packageRepo(pkg string, remap map[string]string, base string) (string, os.F
     }
   }
   
+  repoCacheMu.Lock()
   cached, ok := repoCache[pkg]
+  repoCacheMu.Unlock()
   if ok {
     return cached.Output, cached.Stat, cached.Repo, nil
   }
   
-  repo, err := repoRootForImportPath(pkg, secure)
+  // concurrent lookups of the same package are only resolved once
+  res, err, _ := repoGroup.Do(pkg, func() (interface{}, error) {
+    return resolveRepo(pkg, lock, base)
+  })
   if err != nil {
-    return "", nil, nil, errRepoRootNotFound
+    return "", nil, nil, err
+  }
+  
+  cached = res.(repoInfo)
+  return cached.Output, cached.Stat, cached.Repo, nil
+}
+
+/**
+ * Resolve and cache the repo for a package
+ */
+func resolveRepo(pkg string, lock *lockfile, base string) (repoInfo, error) {
+  
+  var repo *repoRoot
+  if lock != nil {
+    repo, _ = lock.RepoRoot(pkg)
+  }
+  if repo == nil {
+    repo, _ = discovery.RepoRoot(pkg)
+  }
+  if repo == nil {
+    var err error
+    repo, err = repoRootForImportPath(pkg, secure)
+    if err != nil {
+      return repoInfo{}, errRepoRootNotFound
+    }
+    discovery.Add(repo)
   }
   
   output := path.Join(base, repo.root)
   info, err := os.Stat(output)
   if err != nil && !os.IsNotExist(err) {
-    return "", nil, nil, fmt.Errorf("could not read directory: %v\n", err)
+    return repoInfo{}, fmt.Errorf("could not read directory: %v\n", err)
   }
   
-  cached = repoInfo{output, info, repo}
+  cached := repoInfo{output, info, repo}
+  repoCacheMu.Lock()
   repoCache[pkg]        = cached
   repoCache[repo.root]  = cached
+  repoCacheMu.Unlock()
   
-  return output, info, repo, nil
+  return cached, nil
 }
@@ -0,0 +1,228 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+
+package main
+
+import (
+  "fmt"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+const latestStableQuery = "latest-stable"
+
+var semverRegex = regexp.MustCompile("^v?(\\d+)(?:\\.(\\d+))?(?:\\.(\\d+))?(?:-([0-9A-Za-z\\-\\.]+))?(?:\\+[0-9A-Za-z\\-\\.]+)?$")
+
+/**
+ * A semantic version
+ */
+type semver struct {
+  Major, Minor, Patch int
+  Prerelease string
+  Fields int // the number of numeric fields that were actually specified
+}
+
+/**
+ * Parse a semantic version. Versions may omit the minor and patch numbers as
+ * long as they have a leading 'v'; otherwise they must have at least a major
+ * and minor number, so that things like years ('2015') aren't mistaken for
+ * versions.
+ */
+func parseSemver(s string) (semver, bool) {
+  m := semverRegex.FindStringSubmatch(s)
+  if m == nil {
+    return semver{}, false
+  }
+  
+  var v semver
+  for i, e := range []*int{&v.Major, &v.Minor, &v.Patch} {
+    if m[i+1] == "" {
+      break
+    }
+    n, err := strconv.Atoi(m[i+1])
+    if err != nil {
+      return semver{}, false
+    }
+    *e = n
+    v.Fields++
+  }
+  
+  if v.Fields < 2 && !strings.HasPrefix(s, "v") {
+    return semver{}, false
+  }
+  
+  v.Prerelease = m[4]
+  return v, true
+}
+
+/**
+ * Compare versions, returning a negative number if v precedes w, a positive
+ * number if w precedes v, or zero if they are equivalent.
+ */
+func (v semver) Compare(w semver) int {
+  switch {
+    case v.Major != w.Major:
+      return v.Major - w.Major
+    case v.Minor != w.Minor:
+      return v.Minor - w.Minor
+    case v.Patch != w.Patch:
+      return v.Patch - w.Patch
+  }
+  return comparePrerelease(v.Prerelease, w.Prerelease)
+}
+
+/**
+ * Compare prerelease identifiers. A version without a prerelease identifier
+ * has higher precedence than one with it; otherwise dot-separated fields are
+ * compared numerically when both are numbers and lexically otherwise.
+ */
+func comparePrerelease(a, b string) int {
+  switch {
+    case a == b:
+      return 0
+    case a == "":
+      return 1
+    case b == "":
+      return -1
+  }
+  
+  af, bf := strings.Split(a, "."), strings.Split(b, ".")
+  for i := 0; i < len(af) && i < len(bf); i++ {
+    an, aerr := strconv.Atoi(af[i])
+    bn, berr := strconv.Atoi(bf[i])
+    switch {
+      case aerr == nil && berr == nil:
+        if an != bn {
+          return an - bn
+        }
+      case aerr == nil:
+        return -1 // numeric fields precede alphanumeric ones
+      case berr == nil:
+        return 1
+      case af[i] != bf[i]:
+        return strings.Compare(af[i], bf[i])
+    }
+  }
+  
+  return len(af) - len(bf)
+}
+
+/**
+ * A version query selects the highest stable version in the range [Min, Max).
+ * An unbounded query selects the highest stable version overall.
+ */
+type versionQuery struct {
+  Min, Max semver
+  Bounded bool
+}
+
+/**
+ * Determine if a version looks like a query rather than the name of a
+ * specific tag, branch or revision
+ */
+func isVersionQuery(s string) bool {
+  return s == latestStableQuery || strings.HasPrefix(s, "^") || strings.HasPrefix(s, "~")
+}
+
+/**
+ * Parse a version query. Supported queries are:
+ * 
+ *   ^1.4           compatible with 1.4: >= 1.4.0, < 2.0.0 (or < 0.5.0 for ^0.4)
+ *   ~1.4           approximately 1.4: >= 1.4.0, < 1.5.0 (or < 2.0.0 for ~1)
+ *   latest-stable  the highest version that is not a prerelease
+ */
+func parseVersionQuery(s string) (versionQuery, error) {
+  
+  if s == latestStableQuery {
+    return versionQuery{}, nil
+  }
+  if len(s) < 2 || !isVersionQuery(s) {
+    return versionQuery{}, fmt.Errorf("invalid version query: %v", s)
+  }
+  
+  min, ok := parseSemver("v"+strings.TrimPrefix(s[1:], "v")) // '^1' is fine here
+  if !ok || min.Prerelease != "" {
+    return versionQuery{}, fmt.Errorf("invalid version in query: %v", s)
+  }
+  
+  max := semver{Fields: 3}
+  switch s[0] {
+    case '^':
+      switch {
+        case min.Major > 0 || min.Fields < 2:
+          max.Major = min.Major + 1
+        case min.Minor > 0 || min.Fields < 3:
+          max.Minor = min.Minor + 1
+        default:
+          max.Patch = min.Patch + 1
+      }
+    case '~':
+      if min.Fields < 2 {
+        max.Major = min.Major + 1
+      }else{
+        max.Major, max.Minor = min.Major, min.Minor+1
+      }
+  }
+  
+  return versionQuery{min, max, true}, nil
+}
+
+/**
+ * Determine if a version satisfies a query. Prereleases never do.
+ */
+func (q versionQuery) Matches(v semver) bool {
+  if v.Prerelease != "" {
+    return false
+  }
+  if q.Bounded && (v.Compare(q.Min) < 0 || v.Compare(q.Max) >= 0) {
+    return false
+  }
+  return true
+}
+
+/**
+ * Select the tag with the highest version that satisfies a query
+ */
+func selectTag(tags []string, q versionQuery) (string, bool) {
+  var best string
+  var bestv semver
+  for _, e := range tags {
+    v, ok := parseSemver(e)
+    if !ok || !q.Matches(v) {
+      continue
+    }
+    if best == "" || v.Compare(bestv) > 0 {
+      best, bestv = e, v
+    }
+  }
+  return best, best != ""
+}
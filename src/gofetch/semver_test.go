@@ -0,0 +1,157 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "testing"
+)
+
+/**
+ * Test parsing semantic versions
+ */
+func TestParseSemver(t *testing.T) {
+  tests := []struct {
+    In    string
+    Out   semver
+    OK    bool
+  }{
+    {"v1.2.3", semver{1, 2, 3, "", 3}, true},
+    {"1.2.3", semver{1, 2, 3, "", 3}, true},
+    {"v1.2", semver{1, 2, 0, "", 2}, true},
+    {"1.2", semver{1, 2, 0, "", 2}, true},
+    {"v1", semver{1, 0, 0, "", 1}, true},
+    {"v1.2.3-beta.1", semver{1, 2, 3, "beta.1", 3}, true},
+    {"v1.2.3+build.5", semver{1, 2, 3, "", 3}, true},
+    {"v1.2.3-rc.1+build", semver{1, 2, 3, "rc.1", 3}, true},
+    {"2015", semver{}, false},  // a year, not a version
+    {"1", semver{}, false},
+    {"master", semver{}, false},
+    {"v1.2.3.4", semver{}, false},
+    {"v1.x", semver{}, false},
+    {"", semver{}, false},
+  }
+  for _, e := range tests {
+    v, ok := parseSemver(e.In)
+    if ok != e.OK || v != e.Out {
+      t.Errorf("parseSemver(%q) = %+v, %v; expected %+v, %v", e.In, v, ok, e.Out, e.OK)
+    }
+  }
+}
+
+/**
+ * Test comparing semantic versions
+ */
+func TestCompareSemver(t *testing.T) {
+  tests := []struct {
+    A, B  string
+    Sign  int
+  }{
+    {"v1.0.0", "v1.0.0", 0},
+    {"v1.0.0", "v1", 0},
+    {"v1.0.0", "v2.0.0", -1},
+    {"v1.10.0", "v1.9.0", 1},
+    {"v1.0.10", "v1.0.9", 1},
+    {"v1.0.0-alpha", "v1.0.0", -1},
+    {"v1.0.0-alpha", "v1.0.0-alpha.1", -1},
+    {"v1.0.0-alpha.1", "v1.0.0-alpha.beta", -1},
+    {"v1.0.0-alpha.beta", "v1.0.0-beta", -1},
+    {"v1.0.0-beta.2", "v1.0.0-beta.11", -1},
+    {"v1.0.0-rc.1", "v1.0.0", -1},
+  }
+  for _, e := range tests {
+    a, _ := parseSemver(e.A)
+    b, _ := parseSemver(e.B)
+    if c := sign(a.Compare(b)); c != e.Sign {
+      t.Errorf("%v compared to %v = %d; expected %d", e.A, e.B, c, e.Sign)
+    }
+    if c := sign(b.Compare(a)); c != -e.Sign {
+      t.Errorf("%v compared to %v = %d; expected %d", e.B, e.A, c, -e.Sign)
+    }
+  }
+}
+
+/**
+ * Test selecting tags with version queries
+ */
+func TestSelectTag(t *testing.T) {
+  tags := []string{"v0.4.0", "v0.4.2", "v0.5.0", "v1.3.9", "v1.4.0", "v1.4.7", "v1.5.0-rc.1", "v1.6.2", "v2.0.0", "v3.0.0-beta", "2015", "master", "release"}
+  tests := []struct {
+    Query string
+    Tag   string
+    OK    bool
+  }{
+    {"latest-stable", "v2.0.0", true},
+    {"^1.4", "v1.6.2", true},
+    {"^1", "v1.6.2", true},
+    {"^v1", "v1.6.2", true},
+    {"~1.4", "v1.4.7", true},
+    {"~1", "v1.6.2", true},
+    {"^0.4", "v0.4.2", true},
+    {"^1.7", "", false},
+    {"~2.1", "", false},
+    {"^3", "", false}, // prereleases never match
+  }
+  for _, e := range tests {
+    q, err := parseVersionQuery(e.Query)
+    if err != nil {
+      t.Errorf("parseVersionQuery(%q): %v", e.Query, err)
+      continue
+    }
+    tag, ok := selectTag(tags, q)
+    if ok != e.OK || tag != e.Tag {
+      t.Errorf("selectTag(%q) = %q, %v; expected %q, %v", e.Query, tag, ok, e.Tag, e.OK)
+    }
+  }
+}
+
+/**
+ * Test that invalid version queries are rejected
+ */
+func TestParseVersionQueryInvalid(t *testing.T) {
+  for _, e := range []string{"^", "~", "^x", "^1.2.3-beta", "1.2", "latest"} {
+    if _, err := parseVersionQuery(e); err == nil {
+      t.Errorf("parseVersionQuery(%q) succeeded; expected an error", e)
+    }
+  }
+}
+
+/**
+ * Reduce a comparison to its sign
+ */
+func sign(n int) int {
+  switch {
+    case n < 0:
+      return -1
+    case n > 0:
+      return 1
+  }
+  return 0
+}
@@ -0,0 +1,545 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "os"
+  "io"
+  "fmt"
+  "path"
+  "sort"
+  "bytes"
+  "strings"
+  "io/ioutil"
+  "text/tabwriter"
+)
+
+const (
+  statusCurrent   = "current"
+  statusBehind    = "behind"
+  statusModified  = "modified"
+  statusMissing   = "missing"
+  statusUnlocked  = "unlocked"
+  statusUnknown   = "unknown"
+)
+
+/**
+ * The status of a vendored repository compared to its upstream
+ */
+type repoStatus struct {
+  Root      string    `json:"root"`
+  VCS       string    `json:"vcs,omitempty"`
+  Repo      string    `json:"repo,omitempty"`
+  Output    string    `json:"output"`
+  Status    []string  `json:"status"`
+  Version   string    `json:"version,omitempty"`
+  Revision  string    `json:"revision,omitempty"`  // the vendored revision
+  Upstream  string    `json:"upstream,omitempty"`  // the upstream revision at the same version
+  Behind    int       `json:"behind,omitempty"`    // the number of revisions behind upstream, if known
+  NewestTag string    `json:"newestTag,omitempty"` // the newest stable release tag upstream
+  Modified  []string  `json:"modified,omitempty"`  // locally modified files
+  Error     string    `json:"error,omitempty"`
+}
+
+/**
+ * Note a status
+ */
+func (s *repoStatus) Add(status string) {
+  s.Status = append(s.Status, status)
+}
+
+/**
+ * Determine if a repository is behind, modified, missing or couldn't be checked;
+ * one that's only unlocked is otherwise current
+ */
+func (s *repoStatus) Stale() bool {
+  for _, e := range s.Status {
+    if e != statusCurrent && e != statusUnlocked {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Describe the details of a status
+ */
+func (s *repoStatus) Details() string {
+  var d []string
+  if s.Error != "" {
+    d = append(d, s.Error)
+  }
+  if s.Behind > 0 {
+    d = append(d, fmt.Sprintf("%d revision(s) behind %v", s.Behind, shortRevision(s.Upstream)))
+  }else if s.Upstream != "" && s.Revision != "" && s.Upstream != s.Revision {
+    d = append(d, fmt.Sprintf("upstream is at %v", shortRevision(s.Upstream)))
+  }
+  if s.NewestTag != "" && s.NewestTag != s.Version && containsString(s.Status, statusBehind) {
+    d = append(d, fmt.Sprintf("newest tag %v", s.NewestTag))
+  }
+  if n := len(s.Modified); n > 0 {
+    d = append(d, fmt.Sprintf("%d file(s) modified", n))
+  }
+  return strings.Join(d, ", ")
+}
+
+/**
+ * Report the status of vendored repositories
+ */
+func status(args []string) error {
+  
+  fOutput   := cmdline.String ("output",   os.Getenv("PWD"),  "The directory in which packages have been fetched.")
+  fLockfile := cmdline.String ("lockfile", defaultLockfile,   "The lockfile which records the fetched repositories, relative to the output directory. Pass an empty value to only consider repositories detected in the output directory.")
+  cmdline.Parse(args)
+  
+  var lock *lockfile
+  if lockPath := lockfilePath(*fOutput, *fLockfile); lockPath != "" {
+    var err error
+    lock, err = readLockfile(lockPath)
+    if err != nil {
+      return err
+    }
+  }
+  
+  err := loadDiscoveryCache()
+  if err != nil {
+    return err
+  }
+  defer func() {
+    if err := saveDiscoveryCache(); err != nil {
+      reportError(err)
+    }
+  }()
+  
+  repos, err := detectRepos(*fOutput, lock)
+  if err != nil {
+    return err
+  }
+  
+  roots := make([]string, 0, len(repos))
+  for k, _ := range repos {
+    roots = append(roots, k)
+  }
+  sort.Strings(roots)
+  
+  var t *tabwriter.Writer
+  if !optJSON {
+    t = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintf(t, "REPOSITORY\tSTATUS\tREVISION\tDETAILS\n")
+  }
+  
+  var stale int
+  for _, e := range roots {
+    st := repoStatusFor(e, repos[e], lock, *fOutput)
+    if st.Stale() {
+      stale++
+    }
+    if optJSON {
+      if err := writeJSON(st); err != nil {
+        return err
+      }
+    }else{
+      fmt.Fprintf(t, "%v\t%v\t%v\t%v\n", st.Root, strings.Join(st.Status, ", "), shortRevision(st.Revision), st.Details())
+    }
+  }
+  
+  if t != nil {
+    err = t.Flush()
+    if err != nil {
+      return err
+    }
+  }
+  
+  if stale > 0 {
+    return fmt.Errorf("%d repository(s) are not current", stale)
+  }
+  return nil
+}
+
+/**
+ * Find the repositories recorded in the lockfile and those which can be detected
+ * in the output directory, either because they retain VCS metadata or because
+ * their directory resolves to the root of a repository.
+ */
+func detectRepos(outbase string, lock *lockfile) (map[string]*repoRoot, error) {
+  repos := make(map[string]*repoRoot)
+  
+  if lock != nil {
+    for _, e := range lock.Roots() {
+      repos[e], _ = lock.RepoRoot(e)
+    }
+  }
+  
+  err := detectReposInc(repos, outbase, "")
+  if err != nil {
+    return nil, err
+  }
+  
+  return repos, nil
+}
+
+/**
+ * Incrementally detect repositories
+ */
+func detectReposInc(repos map[string]*repoRoot, outbase, rel string) error {
+  dir := path.Join(outbase, rel)
+  
+  if rel != "" {
+    if _, ok := repos[rel]; ok {
+      return nil // already known
+    }
+    for _, v := range vcsList {
+      if hasVCSMetadata(dir, v) {
+        remote, err := v.remoteRepo(v, dir)
+        if err != nil {
+          return fmt.Errorf("could not determine the remote repository of %v: %v", rel, err)
+        }
+        repos[rel] = &repoRoot{vcs: v, repo: remote, root: rel}
+        return nil
+      }
+    }
+  }
+  
+  file, err := os.Open(dir)
+  if err != nil {
+    return err
+  }
+  items, err := file.Readdir(0)
+  file.Close()
+  if err != nil && err != io.EOF {
+    return err
+  }
+  
+  // a directory containing Go sources may be the root of a repository which
+  // has had its VCS files stripped
+  if rel != "" {
+    for _, e := range items {
+      if !e.IsDir() && strings.EqualFold(path.Ext(e.Name()), ".go") {
+        if _, _, repo, err := packageRepo(rel, nil, nil, outbase); err == nil && isDir(path.Join(outbase, repo.root)) {
+          if _, ok := repos[repo.root]; !ok {
+            repos[repo.root] = repo
+          }
+          return nil
+        }
+        break
+      }
+    }
+  }
+  
+  for _, e := range items {
+    if !e.IsDir() || strings.HasPrefix(e.Name(), ".") || strings.HasPrefix(e.Name(), "_") {
+      continue
+    }
+    err := detectReposInc(repos, outbase, path.Join(rel, e.Name()))
+    if err != nil {
+      return err
+    }
+  }
+  
+  return nil
+}
+
+/**
+ * Determine the status of a vendored repository
+ */
+func repoStatusFor(root string, repo *repoRoot, lock *lockfile, outbase string) *repoStatus {
+  dir := path.Join(outbase, root)
+  st := &repoStatus{Root: root, Output: dir}
+  if repo != nil {
+    st.VCS, st.Repo = repo.vcs.cmd, repo.repo
+  }
+  
+  entry, locked := lock.Lookup(root)
+  st.Version, st.Revision = entry.Version, entry.Revision
+  
+  if !isDir(dir) {
+    st.Add(statusMissing)
+    return st
+  }
+  if !locked {
+    st.Add(statusUnlocked)
+  }
+  if repo == nil {
+    st.Add(statusUnknown)
+    st.Error = "could not resolve repository"
+    return st
+  }
+  
+  // a working copy reports its own revision and modifications
+  vcsMetadata := hasVCSMetadata(dir, repo.vcs)
+  if vcsMetadata {
+    rev, err := repo.vcs.revision(dir)
+    if err == nil {
+      st.Revision = rev
+    }
+    st.Modified, err = repo.vcs.modified(dir)
+    if err != nil {
+      st.Add(statusUnknown)
+      st.Error = fmt.Sprintf("could not determine modifications: %v", err)
+      return st
+    }
+  }
+  
+  err := compareUpstream(st, repo, dir, !vcsMetadata)
+  if err != nil {
+    st.Add(statusUnknown)
+    st.Error = strings.TrimSpace(err.Error())
+    return st
+  }
+  
+  if len(st.Modified) > 0 {
+    st.Add(statusModified)
+  }
+  if st.Revision != "" && st.Revision != st.Upstream || newerTag(st.Version, st.NewestTag) {
+    st.Add(statusBehind)
+  }
+  if len(st.Status) < 1 {
+    st.Add(statusCurrent)
+  }
+  
+  return st
+}
+
+/**
+ * A copy of an upstream repository to compare vendored repositories to. Where
+ * the VCS supports it this is the mirror cache, which is refreshed and then
+ * inspected directly; otherwise it's a fresh copy in a temporary directory.
+ */
+type upstreamRepo struct {
+  repo    *repoRoot
+  dir     string
+  mirror  bool    // dir is a mirror, which has no working copy
+  tmp     string  // the temporary directory to remove when we're done
+}
+
+/**
+ * Fetch the upstream of a repository, by refreshing its mirror if possible
+ */
+func openUpstream(repo *repoRoot) (*upstreamRepo, error) {
+  if optCacheDir != "" && repo.vcs.mirrorCmd != nil && repo.vcs.canResolve() {
+    dir, err := repo.vcs.mirror(repo.repo)
+    if err != nil {
+      return nil, fmt.Errorf("could not fetch upstream: %v", err)
+    }
+    return &upstreamRepo{repo: repo, dir: dir, mirror: true}, nil
+  }
+  
+  tmp, err := ioutil.TempDir("", "gofetch-upstream")
+  if err != nil {
+    return nil, err
+  }
+  
+  up := &upstreamRepo{repo: repo, dir: path.Join(tmp, path.Base(repo.root)), tmp: tmp}
+  err = repo.vcs.create(up.dir, repo.repo)
+  if err != nil {
+    up.Close()
+    return nil, fmt.Errorf("could not fetch upstream: %v", err)
+  }
+  
+  return up, nil
+}
+
+/**
+ * Clean up
+ */
+func (u *upstreamRepo) Close() {
+  if u.tmp != "" {
+    os.RemoveAll(u.tmp)
+  }
+}
+
+/**
+ * Determine the revision a version refers to upstream, which is resolved the
+ * same way it is when fetching
+ */
+func (u *upstreamRepo) Resolve(version string) (string, error) {
+  vcs := u.repo.vcs
+  
+  if !u.mirror {
+    err := syncVersion(u.dir, u.repo, version)
+    if err != nil {
+      return "", err
+    }
+    return vcs.revision(u.dir)
+  }
+  
+  if isVersionQuery(version) {
+    q, err := parseVersionQuery(version)
+    if err != nil {
+      return "", err
+    }
+    tags, err := vcs.releaseTags(u.dir)
+    if err != nil {
+      return "", fmt.Errorf("could not list tags: %v", err)
+    }
+    tag, ok := selectTag(tags, q)
+    if !ok {
+      return "", fmt.Errorf("no tag matches %v", version)
+    }
+    version = tag
+  }
+  
+  return vcs.resolveRevision(u.dir, version)
+}
+
+/**
+ * Produce a working copy of the upstream repository at a revision. A mirror is
+ * left alone and the working copy is created from it in a temporary directory.
+ */
+func (u *upstreamRepo) Checkout(rev string) (string, error) {
+  dir := u.dir
+  
+  if u.mirror {
+    tmp, err := ioutil.TempDir("", "gofetch-upstream")
+    if err != nil {
+      return "", err
+    }
+    u.tmp = tmp
+    dir = path.Join(tmp, path.Base(u.repo.root))
+    err = u.repo.vcs.createFrom(dir, u.dir)
+    if err != nil {
+      return "", err
+    }
+  }
+  
+  err := u.repo.vcs.revisionSync(dir, rev)
+  if err != nil {
+    return "", err
+  }
+  
+  return dir, nil
+}
+
+/**
+ * Compare a vendored repository to its upstream at the same version, noting the
+ * upstream revision, how far behind the vendored revision is and the newest
+ * release tag. If requested, the vendored files are also compared to those at
+ * the vendored revision to find local modifications.
+ */
+func compareUpstream(st *repoStatus, repo *repoRoot, dir string, files bool) error {
+  
+  up, err := openUpstream(repo)
+  if err != nil {
+    return err
+  }
+  defer up.Close()
+  
+  st.Upstream, err = up.Resolve(st.Version)
+  if err != nil {
+    return fmt.Errorf("could not resolve version %q upstream: %v", st.Version, err)
+  }
+  
+  if tags, err := repo.vcs.releaseTags(up.dir); err == nil {
+    q, _ := parseVersionQuery("latest-stable")
+    st.NewestTag, _ = selectTag(tags, q)
+  }
+  
+  // count the revisions we're behind; if the vendored revision isn't an
+  // ancestor upstream we can't, but that's fine
+  if st.Revision != "" && st.Revision != st.Upstream {
+    if n, err := repo.vcs.revisionsSince(up.dir, st.Revision, st.Upstream); err == nil && n > 0 {
+      st.Behind = n
+    }
+  }
+  
+  if files && st.Revision != "" {
+    ref, err := up.Checkout(st.Revision)
+    if err != nil {
+      return fmt.Errorf("could not check out vendored revision %v upstream: %v", st.Revision, err)
+    }
+    return compareFiles(st, dir, ref)
+  }
+  
+  return nil
+}
+
+/**
+ * Note the files in a vendored repository which are not identical to those in
+ * a reference copy. Files which are missing from the vendored repository are
+ * not noted, since they may have been stripped.
+ */
+func compareFiles(st *repoStatus, dir, ref string) error {
+  return compareFilesInc(st, dir, ref, "")
+}
+
+/**
+ * Incrementally compare files
+ */
+func compareFilesInc(st *repoStatus, dir, ref, rel string) error {
+  
+  file, err := os.Open(path.Join(dir, rel))
+  if err != nil {
+    return err
+  }
+  items, err := file.Readdir(0)
+  file.Close()
+  if err != nil && err != io.EOF {
+    return err
+  }
+  
+  sort.Slice(items, func(i, j int) bool { return items[i].Name() < items[j].Name() })
+  for _, e := range items {
+    p := path.Join(rel, e.Name())
+    if vcsFileFilter(p) {
+      continue
+    }
+    if e.IsDir() {
+      err = compareFilesInc(st, dir, ref, p)
+      if err != nil {
+        return err
+      }
+      continue
+    }
+    a, err := ioutil.ReadFile(path.Join(dir, p))
+    if err != nil {
+      return err
+    }
+    b, err := ioutil.ReadFile(path.Join(ref, p))
+    if err != nil || !bytes.Equal(a, b) {
+      st.Modified = append(st.Modified, p)
+    }
+  }
+  
+  return nil
+}
+
+/**
+ * Determine if a tag is a newer version than the one a repository is pinned to.
+ * If the pinned version isn't a tag we can't tell.
+ */
+func newerTag(version, tag string) bool {
+  v, ok := parseSemver(version)
+  if !ok {
+    return false
+  }
+  t, ok := parseSemver(tag)
+  return ok && t.Compare(v) > 0
+}
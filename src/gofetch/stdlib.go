@@ -0,0 +1,174 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "runtime"
+)
+
+/**
+ * Standard library packages and the minor version of Go 1 in which each was
+ * introduced, as recorded by the API files of the Go distribution. Packages
+ * which could be imported before they had any exported API (e.g., runtime/cgo)
+ * are listed at the release they first appeared in instead. Internal packages
+ * can't be imported from outside the standard library and aren't listed.
+ */
+var standardPackages = map[string]int{
+  "archive/tar": 0, "archive/zip": 0, "bufio": 0, "bytes": 0, "cmp": 21,
+  "compress/bzip2": 0, "compress/flate": 0, "compress/gzip": 0, "compress/lzw": 0,
+  "compress/zlib": 0, "container/heap": 0, "container/list": 0, "container/ring": 0,
+  "context": 7, "crypto": 0, "crypto/aes": 0, "crypto/cipher": 0, "crypto/des": 0,
+  "crypto/dsa": 0, "crypto/ecdh": 20, "crypto/ecdsa": 0, "crypto/ed25519": 13,
+  "crypto/elliptic": 0, "crypto/fips140": 24, "crypto/hkdf": 24, "crypto/hmac": 0,
+  "crypto/hpke": 26, "crypto/md5": 0, "crypto/mldsa": 27, "crypto/mlkem": 24,
+  "crypto/mlkem/mlkemtest": 26, "crypto/pbkdf2": 24, "crypto/rand": 0, "crypto/rc4": 0,
+  "crypto/rsa": 0, "crypto/sha1": 0, "crypto/sha256": 0, "crypto/sha3": 24,
+  "crypto/sha512": 0, "crypto/subtle": 0, "crypto/tls": 0, "crypto/x509": 0,
+  "crypto/x509/pkix": 0, "database/sql": 0, "database/sql/driver": 0,
+  "debug/buildinfo": 18, "debug/dwarf": 0, "debug/elf": 0, "debug/gosym": 0,
+  "debug/macho": 0, "debug/pe": 0, "debug/plan9obj": 3, "embed": 16, "encoding": 2,
+  "encoding/ascii85": 0, "encoding/asn1": 0, "encoding/base32": 0, "encoding/base64": 0,
+  "encoding/binary": 0, "encoding/csv": 0, "encoding/gob": 0, "encoding/hex": 0,
+  "encoding/json": 0, "encoding/json/jsontext": 27, "encoding/json/v2": 27,
+  "encoding/pem": 0, "encoding/xml": 0, "errors": 0, "expvar": 0, "flag": 0, "fmt": 0,
+  "go/ast": 0, "go/build": 0, "go/build/constraint": 16, "go/constant": 5, "go/doc": 0,
+  "go/doc/comment": 19, "go/format": 1, "go/importer": 5, "go/parser": 0, "go/printer": 0,
+  "go/scanner": 0, "go/token": 0, "go/types": 5, "go/version": 22, "hash": 0,
+  "hash/adler32": 0, "hash/crc32": 0, "hash/crc64": 0, "hash/fnv": 0, "hash/maphash": 14,
+  "html": 0, "html/template": 0, "image": 0, "image/color": 0, "image/color/palette": 2,
+  "image/draw": 0, "image/gif": 0, "image/jpeg": 0, "image/png": 0,
+  "index/suffixarray": 0, "io": 0, "io/fs": 16, "io/ioutil": 0, "iter": 23, "log": 0,
+  "log/slog": 21, "log/syslog": 0, "maps": 21, "math": 0, "math/big": 0, "math/bits": 9,
+  "math/cmplx": 0, "math/rand": 0, "math/rand/v2": 22, "mime": 0, "mime/multipart": 0,
+  "mime/quotedprintable": 5, "net": 0, "net/http": 0, "net/http/cgi": 0,
+  "net/http/cookiejar": 1, "net/http/fcgi": 0, "net/http/httptest": 0,
+  "net/http/httptrace": 7, "net/http/httputil": 0, "net/http/pprof": 0, "net/mail": 0,
+  "net/netip": 18, "net/rpc": 0, "net/rpc/jsonrpc": 0, "net/smtp": 0, "net/textproto": 0,
+  "net/url": 0, "os": 0, "os/exec": 0, "os/signal": 0, "os/user": 0, "path": 0,
+  "path/filepath": 0, "plugin": 8, "reflect": 0, "regexp": 0, "regexp/syntax": 0,
+  "runtime": 0, "runtime/cgo": 0, "runtime/coverage": 20, "runtime/debug": 0,
+  "runtime/metrics": 16, "runtime/pprof": 0, "runtime/race": 1, "runtime/trace": 5,
+  "slices": 21, "sort": 0, "strconv": 0, "strings": 0, "structs": 23, "sync": 0,
+  "sync/atomic": 0, "syscall": 0, "syscall/js": 11, "testing": 0, "testing/cryptotest": 26,
+  "testing/fstest": 16, "testing/iotest": 0, "testing/quick": 0, "testing/slogtest": 21,
+  "testing/synctest": 25, "text/scanner": 0, "text/tabwriter": 0, "text/template": 0,
+  "text/template/parse": 0, "time": 0, "time/tzdata": 15, "unicode": 0,
+  "unicode/utf16": 0, "unicode/utf8": 0, "unique": 23, "unsafe": 0, "uuid": 27,
+  "weak": 24,
+  "C": 0, // cgo
+}
+
+/**
+ * The latest release described by standardPackages. Packages in later releases
+ * can only be recognized by their top-level element.
+ */
+const standardPackagesVersion = 27
+
+/**
+ * Parse a Go version (e.g., '1.21', 'go1.21.3') and produce its minor version.
+ * An empty version or 'all' produces -1, which matches every release.
+ */
+func parseGoVersion(v string) (int, error) {
+  if v == "" || v == allBuildValues {
+    return -1, nil
+  }
+  
+  s := strings.TrimPrefix(v, "go")
+  p := strings.Split(s, ".")
+  if len(p) < 2 || p[0] != "1" {
+    return 0, fmt.Errorf("invalid Go version: %v", v)
+  }
+  
+  m, err := strconv.Atoi(p[1])
+  if err != nil || m < 0 {
+    return 0, fmt.Errorf("invalid Go version: %v", v)
+  }
+  
+  return m, nil
+}
+
+/**
+ * The Go version gofetch was built with, which is the default target. Development
+ * builds target every release.
+ */
+func defaultGoVersion() string {
+  v := runtime.Version()
+  if _, err := parseGoVersion(v); err != nil {
+    return allBuildValues
+  }
+  if p := strings.Split(v, "."); len(p) > 2 {
+    v = strings.Join(p[:2], ".")
+  }
+  return v
+}
+
+/**
+ * Determine if an import path refers to a standard library package in the Go
+ * release with the provided minor version (or any release, if negative). A
+ * package we don't know about which shares its top-level element with one we
+ * do (and which therefore can't be fetched anyway) is assumed to come from a
+ * release later than those we know about.
+ */
+func isStandardPackage(n string, minor int) bool {
+  if since, ok := standardPackages[n]; ok {
+    return minor < 0 || since <= minor
+  }
+  if minor >= 0 && minor <= standardPackagesVersion {
+    return false
+  }
+  root := n
+  if i := strings.Index(n, "/"); i >= 0 {
+    root = n[:i]
+  }
+  for e, _ := range standardPackages {
+    if e == root || strings.HasPrefix(e, root+"/") {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Determine if an import path is within one of the provided prefixes, which
+ * identify packages that are local to the project
+ */
+func isLocalPackage(n string, prefixes []string) bool {
+  for _, e := range prefixes {
+    e = strings.TrimSuffix(e, "/")
+    if n == e || strings.HasPrefix(n, e+"/") {
+      return true
+    }
+  }
+  return false
+}
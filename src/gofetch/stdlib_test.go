@@ -0,0 +1,72 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "testing"
+)
+
+/**
+ * Test recognizing standard library packages for a Go release
+ */
+func TestIsStandardPackage(t *testing.T) {
+  tests := []struct {
+    Package string
+    Minor   int
+    OK      bool
+  }{
+    {"fmt", 0, true},
+    {"net/http", -1, true},
+    {"net/netip", 17, false},
+    {"net/netip", 18, true},
+    {"net", 17, true},
+    {"math/rand/v2", 21, false},
+    {"math/rand/v2", 22, true},
+    {"math/rand", 21, true},
+    {"context", 6, false},
+    {"context", 7, true},
+    {"slices", 20, false},
+    {"C", 0, true},
+    {"runtime/cgo", 0, true},   // importable long before it had exported API
+    {"syscall/js", 11, true},
+    {"syscall/js", 10, false},
+    {"net/notyet", -1, true},   // unknown, but can only be standard
+    {"net/notyet", 21, false},  // unknown, and we know what 1.21 had
+    {"net/notyet", standardPackagesVersion+1, true},
+    {"github.com/stretchr/testify", -1, false},
+    {"fmtx", -1, false},
+  }
+  for _, e := range tests {
+    if ok := isStandardPackage(e.Package, e.Minor); ok != e.OK {
+      t.Errorf("isStandardPackage(%q, %d) = %v; expected %v", e.Package, e.Minor, ok, e.OK)
+    }
+  }
+}
@@ -35,6 +35,12 @@ import (
   "io"
   "fmt"
   "path"
+  "sort"
+  "sync"
+  "strconv"
+  "strings"
+  "io/ioutil"
+  "path/filepath"
 )
 
 type pathFilter func(string)(bool)
@@ -47,6 +53,182 @@ func vcsFileFilter(p string) bool {
   return n == ".git" || n == ".svn" || n == ".hg" || n == ".bzr"
 }
 
+/**
+ * Match Go test files
+ */
+func testFileFilter(p string) bool {
+  return strings.HasSuffix(path.Base(p), "_test.go")
+}
+
+/**
+ * Match testdata directories
+ */
+func testdataFilter(p string) bool {
+  return path.Base(p) == "testdata" && isDir(p)
+}
+
+/**
+ * Match example directories and example test files
+ */
+func examplesFilter(p string) bool {
+  n := path.Base(p)
+  switch n {
+    case "example", "examples", "_example", "_examples":
+      return isDir(p)
+  }
+  return strings.HasPrefix(n, "example") && strings.HasSuffix(n, "_test.go")
+}
+
+/**
+ * Files which are needed to build a package, or which must be retained along
+ * with its source, and are therefore never matched by nonGoFileFilter
+ */
+var buildFileExts = []string{".go", ".s", ".S", ".sx", ".c", ".h", ".cc", ".cpp", ".cxx", ".hh", ".hpp", ".hxx", ".m", ".f", ".F", ".for", ".f90", ".swig", ".swigcxx", ".syso"}
+var legalFilePrefixes = []string{"LICENSE", "LICENCE", "COPYING", "NOTICE", "PATENTS", "AUTHORS", "CONTRIBUTORS", "UNLICENSE"}
+
+/**
+ * Match files which are not Go source or otherwise needed to build a package.
+ * License and similar legal files are retained, as are files embedded by a
+ * '//go:embed' directive.
+ */
+func nonGoFileFilter(p string) bool {
+  if isDir(p) {
+    return false
+  }
+  n := path.Base(p)
+  if containsString(buildFileExts, path.Ext(n)) {
+    return false
+  }
+  u := strings.ToUpper(n)
+  for _, e := range legalFilePrefixes {
+    if strings.HasPrefix(u, e) {
+      return false
+    }
+  }
+  return !isEmbedded(p)
+}
+
+var (
+  embedCacheMu sync.Mutex
+  embedCache   = make(map[string][]string)
+)
+
+/**
+ * Determine if a file is embedded by a '//go:embed' directive in a package in
+ * any of the directories above it. Patterns are matched the way the compiler
+ * matches them, except that files which a pattern for a directory would skip
+ * (hidden ones and those prefixed with '_') are matched anyway; keeping a file
+ * we don't need is harmless, the reverse is not.
+ */
+func isEmbedded(p string) bool {
+  for d := path.Dir(p); d != "." && d != "/"; d = path.Dir(d) {
+    rel := p[len(d)+1:]
+    for _, e := range embedPatterns(d) {
+      e = strings.TrimPrefix(e, "all:")
+      for m := rel; m != "."; m = path.Dir(m) {
+        if ok, _ := path.Match(e, m); ok {
+          return true
+        }
+      }
+    }
+  }
+  return false
+}
+
+/**
+ * Obtain the '//go:embed' patterns in the Go sources in a directory
+ */
+func embedPatterns(dir string) []string {
+  embedCacheMu.Lock()
+  defer embedCacheMu.Unlock()
+  
+  if l, ok := embedCache[dir]; ok {
+    return l
+  }
+  
+  var l []string
+  srcs, _ := filepath.Glob(path.Join(dir, "*.go"))
+  for _, e := range srcs {
+    data, err := ioutil.ReadFile(e)
+    if err != nil {
+      continue
+    }
+    for _, line := range strings.Split(string(data), "\n") {
+      if line = strings.TrimSpace(line); strings.HasPrefix(line, "//go:embed ") {
+        l = append(l, parseEmbedPatterns(line[len("//go:embed "):])...)
+      }
+    }
+  }
+  
+  embedCache[dir] = l
+  return l
+}
+
+/**
+ * Parse the patterns in a '//go:embed' directive, which are separated by spaces
+ * and may be quoted
+ */
+func parseEmbedPatterns(s string) []string {
+  var l []string
+  for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+    var e string
+    if s[0] == '"' || s[0] == '`' {
+      i := strings.IndexByte(s[1:], s[0])
+      if i < 0 {
+        break // malformed, the compiler will complain
+      }
+      e, s = s[:i+2], s[i+2:]
+      if v, err := strconv.Unquote(e); err == nil {
+        e = v
+      }
+    }else if i := strings.IndexAny(s, " \t"); i >= 0 {
+      e, s = s[:i], s[i:]
+    }else{
+      e, s = s, ""
+    }
+    l = append(l, e)
+  }
+  return l
+}
+
+/**
+ * Produce a filter which matches a path when any of the provided filters
+ * matches it
+ */
+func anyFilter(filters ...pathFilter) pathFilter {
+  return func(p string) bool {
+    for _, e := range filters {
+      if e(p) {
+        return true
+      }
+    }
+    return false
+  }
+}
+
+/**
+ * Produce a filter which never matches anything inside a VCS metadata
+ * directory, so that pruning can't damage a retained working copy
+ */
+func outsideVCSFilter(filter pathFilter) pathFilter {
+  return func(p string) bool {
+    for d := path.Dir(p); d != "." && d != "/"; d = path.Dir(d) {
+      if vcsFileFilter(d) {
+        return false
+      }
+    }
+    return filter(p)
+  }
+}
+
+/**
+ * Determine if a path is a directory
+ */
+func isDir(p string) bool {
+  info, err := os.Stat(p)
+  return err == nil && info.IsDir()
+}
+
 /**
  * Delete files in a directory hierarchy which match the provided filter.
  */
@@ -87,6 +269,76 @@ func prunePath(dir string, filter pathFilter, rec bool) error {
   return nil
 }
 
+/**
+ * Remove a directory hierarchy and then any parent directories, up to but not
+ * including the base directory, which are left empty as a result.
+ */
+func removeAllAndEmptyParents(dir, base string) error {
+  
+  err := os.RemoveAll(dir)
+  if err != nil {
+    return err
+  }
+  
+  base = path.Clean(base)
+  for p := path.Dir(dir); p != base && p != "." && p != "/"; p = path.Dir(p) {
+    if os.Remove(p) != nil {
+      break // not empty, most likely
+    }
+  }
+  
+  return nil
+}
+
+/**
+ * Determine if a list contains a string
+ */
+func containsString(l []string, v string) bool {
+  for _, e := range l {
+    if e == v {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Obtain the members of a set in order. The result is never nil, so it's
+ * serialized as an empty list.
+ */
+func sortedSet(m map[string]struct{}) []string {
+  keys := make([]string, 0, len(m))
+  for k, _ := range m {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+/**
+ * Obtain the keys of a map of sets, like an import graph, in order
+ */
+func sortedGraphKeys(m map[string]map[string]struct{}) []string {
+  keys := make([]string, 0, len(m))
+  for k, _ := range m {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+/**
+ * Obtain the keys of a map of strings in order
+ */
+func sortedStringKeys(m map[string]string) []string {
+  keys := make([]string, 0, len(m))
+  for k, _ := range m {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
 /**
  * String list for flags
  */
@@ -106,3 +358,110 @@ func (s *stringList) Set(v string) error {
 func (s *stringList) String() string {
   return fmt.Sprintf("%+v", *s)
 }
+
+/**
+ * A set of strings which is safe for concurrent use
+ */
+type stringSet struct {
+  sync.Mutex
+  m map[string]struct{}
+}
+
+/**
+ * Create a string set
+ */
+func newStringSet() *stringSet {
+  return &stringSet{m: make(map[string]struct{})}
+}
+
+/**
+ * Add a string to the set. True is returned if the string was added, false if
+ * it was already present.
+ */
+func (s *stringSet) Add(v string) bool {
+  s.Lock()
+  defer s.Unlock()
+  if _, ok := s.m[v]; ok {
+    return false
+  }
+  s.m[v] = struct{}{}
+  return true
+}
+
+/**
+ * Determine if the set contains a string
+ */
+func (s *stringSet) Contains(v string) bool {
+  s.Lock()
+  defer s.Unlock()
+  _, ok := s.m[v]
+  return ok
+}
+
+/**
+ * A claim on some work. The first party to claim it performs the work and
+ * finishes the claim; everyone else may wait for it to be finished.
+ */
+type claim struct {
+  done chan struct{}
+  err error
+}
+
+/**
+ * Finish a claim with the result of the work
+ */
+func (c *claim) Finish(err error) {
+  c.err = err
+  close(c.done)
+}
+
+/**
+ * Wait for a claim to be finished and return the result of the work
+ */
+func (c *claim) Wait() error {
+  <-c.done
+  return c.err
+}
+
+/**
+ * A set of claims, keyed by string, which is safe for concurrent use
+ */
+type claimSet struct {
+  sync.Mutex
+  m map[string]*claim
+}
+
+/**
+ * Create a claim set
+ */
+func newClaimSet() *claimSet {
+  return &claimSet{m: make(map[string]*claim)}
+}
+
+/**
+ * Obtain every key that has been claimed
+ */
+func (s *claimSet) Keys() []string {
+  s.Lock()
+  defer s.Unlock()
+  keys := make([]string, 0, len(s.m))
+  for k, _ := range s.m {
+    keys = append(keys, k)
+  }
+  return keys
+}
+
+/**
+ * Claim a key. The claim is returned along with true if the caller is the first
+ * to claim the key and must therefore perform the work and finish it.
+ */
+func (s *claimSet) Claim(key string) (*claim, bool) {
+  s.Lock()
+  defer s.Unlock()
+  if c, ok := s.m[key]; ok {
+    return c, false
+  }
+  c := &claim{done: make(chan struct{})}
+  s.m[key] = c
+  return c, true
+}
@@ -0,0 +1,103 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "os"
+  "path"
+  "reflect"
+  "testing"
+  "io/ioutil"
+)
+
+/**
+ * Test stripping files which aren't needed to build a package
+ */
+func TestStripNonGo(t *testing.T) {
+  
+  base, err := ioutil.TempDir("", "gofetch-test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(base)
+  
+  writeTestTree(t, base, map[string]string{
+    "pkg/pkg.go":             "package pkg\n\nimport \"embed\"\n\n//go:embed static/*.css \"my file.txt\"\n//go:embed all:assets\nvar files embed.FS\n",
+    "pkg/asm_amd64.S":        "\n",
+    "pkg/asm_arm64.sx":       "\n",
+    "pkg/cgo.h":              "\n",
+    "pkg/static/a.css":       "\n",
+    "pkg/static/b.js":        "\n",
+    "pkg/my file.txt":        "\n",
+    "pkg/assets/.hidden":     "\n",
+    "pkg/assets/img/x.png":   "\n",
+    "pkg/other.txt":          "\n",
+    "LICENSE":                "\n",
+    "README.md":              "\n",
+  })
+  
+  err = prunePath(base, nonGoFileFilter, true)
+  if err != nil {
+    t.Fatal(err)
+  }
+  
+  for _, e := range []string{"pkg/pkg.go", "pkg/asm_amd64.S", "pkg/asm_arm64.sx", "pkg/cgo.h", "pkg/static/a.css", "pkg/my file.txt", "pkg/assets/.hidden", "pkg/assets/img/x.png", "LICENSE"} {
+    if _, err := os.Stat(path.Join(base, e)); err != nil {
+      t.Errorf("expected %v to be retained: %v", e, err)
+    }
+  }
+  for _, e := range []string{"pkg/static/b.js", "pkg/other.txt", "README.md"} {
+    if _, err := os.Stat(path.Join(base, e)); !os.IsNotExist(err) {
+      t.Errorf("expected %v to be stripped", e)
+    }
+  }
+  
+}
+
+/**
+ * Test parsing '//go:embed' patterns
+ */
+func TestParseEmbedPatterns(t *testing.T) {
+  tests := []struct {
+    In  string
+    Out []string
+  }{
+    {"a.txt", []string{"a.txt"}},
+    {"  a.txt   b/*.css\t", []string{"a.txt", "b/*.css"}},
+    {"\"with space.txt\" `raw name.txt` all:dir", []string{"with space.txt", "raw name.txt", "all:dir"}},
+    {"", nil},
+  }
+  for _, e := range tests {
+    if l := parseEmbedPatterns(e.In); !reflect.DeepEqual(l, e.Out) {
+      t.Errorf("parseEmbedPatterns(%q) = %q; expected %q", e.In, l, e.Out)
+    }
+  }
+}
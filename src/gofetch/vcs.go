@@ -10,11 +10,14 @@ import (
 	"errors"
 	"fmt"
 	"gofetch/singleflight"
+	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -57,15 +60,28 @@ type vcsCmd struct {
 	downloadCmd []string // commands to download updates into an existing repository
 
 	tagCmd         []tagCmd // commands to list tags
+	releaseTagCmd  []tagCmd // commands to list release tags only, if tagCmd also lists branches
 	tagLookupCmd   []tagCmd // commands to lookup tags before running tagSyncCmd
 	tagSyncCmd     []string // commands to sync to specific tag
 	tagSyncDefault []string // commands to sync to default tag
 
+	revisionCmd        tagCmd   // command to report the current revision
+	revisionSyncCmd    []string // commands to sync to a specific revision
+	revisionResolveCmd tagCmd   // command to resolve {rev} to a revision without a working copy, if supported
+	revisionHead       string   // the {rev} which revisionResolveCmd resolves for the default branch
+	revisionCountCmd   string   // command to count the revisions from {rev} to {head}, if supported
+	revisionTagsCmd    tagCmd   // command to list the tags at {rev}, if supported
+	statusCmd          string   // command to list locally modified files, one per line
+
+	mirrorCmd     []string // commands to create a bare mirror of a repository
+	mirrorSyncCmd []string // commands to download updates into an existing mirror
+
 	scheme  []string
 	pingCmd string
 
 	remoteRepo  func(v *vcsCmd, rootDir string) (remoteRepo string, err error)
 	resolveRepo func(v *vcsCmd, rootDir, remoteRepo string) (realRepo string, err error)
+	setRemote   func(v *vcsCmd, rootDir, remoteRepo string) error
 }
 
 var isSecureScheme = map[string]bool{
@@ -131,9 +147,20 @@ var vcsHg = &vcsCmd{
 	tagSyncCmd:     []string{"update -r {tag}"},
 	tagSyncDefault: []string{"update default"},
 
+	revisionCmd:        tagCmd{"log -r . --template {node}", `^([0-9a-f]+)$`},
+	revisionSyncCmd:    []string{"update -r {rev}"},
+	revisionResolveCmd: tagCmd{"log -r {rev} --template {node}", `^([0-9a-f]+)$`},
+	revisionHead:       "default",
+	revisionTagsCmd:    tagCmd{"log -r {rev} --template {tags}", `(\S+)`},
+	statusCmd:          "status",
+
+	mirrorCmd:     []string{"clone -U {repo} {dir}"},
+	mirrorSyncCmd: []string{"pull"},
+
 	scheme:     []string{"https", "http", "ssh"},
 	pingCmd:    "identify {scheme}://{repo}",
 	remoteRepo: hgRemoteRepo,
+	setRemote:  hgSetRemote,
 }
 
 func hgRemoteRepo(vcsHg *vcsCmd, rootDir string) (remoteRepo string, err error) {
@@ -144,6 +171,13 @@ func hgRemoteRepo(vcsHg *vcsCmd, rootDir string) (remoteRepo string, err error)
 	return strings.TrimSpace(string(out)), nil
 }
 
+func hgSetRemote(vcsHg *vcsCmd, rootDir, remoteRepo string) error {
+	// Mercurial has no command to change the default path; the clone's
+	// hgrc only records that path, so it is simply rewritten.
+	hgrc := filepath.Join(rootDir, ".hg", "hgrc")
+	return ioutil.WriteFile(hgrc, []byte("[paths]\ndefault = "+remoteRepo+"\n"), 0644)
+}
+
 // vcsGit describes how to use Git.
 var vcsGit = &vcsCmd{
 	name: "Git",
@@ -157,6 +191,9 @@ var vcsGit = &vcsCmd{
 		// origin/xxx matches a git branch named xxx on the default remote repository
 		{"show-ref", `(?:tags|origin)/(\S+)$`},
 	},
+	releaseTagCmd: []tagCmd{
+		{"tag -l", `^(\S+)$`},
+	},
 	tagLookupCmd: []tagCmd{
 		{"show-ref tags/{tag} origin/{tag}", `((?:tags|origin)/\S+)$`},
 	},
@@ -167,9 +204,21 @@ var vcsGit = &vcsCmd{
 	// See golang.org/issue/9032.
 	tagSyncDefault: []string{"checkout master", "submodule update --init --recursive"},
 
+	revisionCmd:        tagCmd{"rev-parse HEAD", `^([0-9a-f]+)$`},
+	revisionSyncCmd:    []string{"checkout {rev}", "submodule update --init --recursive"},
+	revisionResolveCmd: tagCmd{"rev-parse --verify {rev}^{commit}", `^([0-9a-f]+)$`},
+	revisionHead:       "HEAD",
+	revisionCountCmd:   "rev-list --count {rev}..{head}",
+	revisionTagsCmd:    tagCmd{"tag --points-at {rev}", `^(\S+)$`},
+	statusCmd:          "status --porcelain",
+
+	mirrorCmd:     []string{"clone --mirror {repo} {dir}"},
+	mirrorSyncCmd: []string{"remote update --prune"},
+
 	scheme:     []string{"git", "https", "http", "git+ssh", "ssh"},
 	pingCmd:    "ls-remote {scheme}://{repo}",
 	remoteRepo: gitRemoteRepo,
+	setRemote:  gitSetRemote,
 }
 
 // scpSyntaxRe matches the SCP-like addresses used by Git to access
@@ -220,6 +269,10 @@ func gitRemoteRepo(vcsGit *vcsCmd, rootDir string) (remoteRepo string, err error
 	return "", errParse
 }
 
+func gitSetRemote(vcsGit *vcsCmd, rootDir, remoteRepo string) error {
+	return vcsGit.run(rootDir, "remote set-url origin {repo}", "repo", remoteRepo)
+}
+
 // vcsBzr describes how to use Bazaar.
 var vcsBzr = &vcsCmd{
 	name: "Bazaar",
@@ -235,10 +288,18 @@ var vcsBzr = &vcsCmd{
 	tagSyncCmd:     []string{"update -r {tag}"},
 	tagSyncDefault: []string{"update -r revno:-1"},
 
+	revisionCmd:     tagCmd{"revno", `^(\S+)$`},
+	revisionSyncCmd: []string{"update -r {rev}"},
+	statusCmd:       "status --short",
+
+	mirrorCmd:     []string{"branch --no-tree {repo} {dir}"},
+	mirrorSyncCmd: []string{"pull --overwrite"},
+
 	scheme:      []string{"https", "http", "bzr", "bzr+ssh"},
 	pingCmd:     "info {scheme}://{repo}",
 	remoteRepo:  bzrRemoteRepo,
 	resolveRepo: bzrResolveRepo,
+	setRemote:   bzrSetRemote,
 }
 
 func bzrRemoteRepo(vcsBzr *vcsCmd, rootDir string) (remoteRepo string, err error) {
@@ -249,6 +310,10 @@ func bzrRemoteRepo(vcsBzr *vcsCmd, rootDir string) (remoteRepo string, err error
 	return strings.TrimSpace(string(outb)), nil
 }
 
+func bzrSetRemote(vcsBzr *vcsCmd, rootDir, remoteRepo string) error {
+	return vcsBzr.run(rootDir, "config parent_location={repo}", "repo", remoteRepo)
+}
+
 func bzrResolveRepo(vcsBzr *vcsCmd, rootDir, remoteRepo string) (realRepo string, err error) {
 	outb, err := vcsBzr.runOutput(rootDir, "info "+remoteRepo)
 	if err != nil {
@@ -293,6 +358,10 @@ var vcsSvn = &vcsCmd{
 	// There is no tag command in subversion.
 	// The branch information is all in the path names.
 
+	revisionCmd:     tagCmd{"info", `^Revision: (\d+)$`},
+	revisionSyncCmd: []string{"update -r {rev}"},
+	statusCmd:       "status",
+
 	scheme:     []string{"https", "http", "svn", "svn+ssh"},
 	pingCmd:    "info {scheme}://{repo}",
 	remoteRepo: svnRemoteRepo,
@@ -350,6 +419,9 @@ func (v *vcsCmd) runOutput(dir string, cmd string, keyval ...string) ([]byte, er
 	return v.run1(dir, cmd, keyval, true)
 }
 
+// stderrMu serializes diagnostic output from commands run concurrently.
+var stderrMu sync.Mutex
+
 // run1 is the generalized implementation of run and runOutput.
 func (v *vcsCmd) run1(dir string, cmdline string, keyval []string, verbose bool) ([]byte, error) {
 	m := make(map[string]string)
@@ -370,14 +442,14 @@ func (v *vcsCmd) run1(dir string, cmdline string, keyval []string, verbose bool)
 	}
 
 	if optDebug {
-		fmt.Println("#", v.cmd, strings.Join(args, " "))
+		notice("# %s %s", v.cmd, strings.Join(args, " "))
 	}
 	cmd := exec.Command(v.cmd, args...)
 	cmd.Dir = dir
 	cmd.Env = envForDir(cmd.Dir, os.Environ())
 	if buildX {
-		fmt.Printf("cd %s\n", dir)
-		fmt.Printf("%s %s\n", v.cmd, strings.Join(args, " "))
+		notice("cd %s", dir)
+		notice("%s %s", v.cmd, strings.Join(args, " "))
 	}
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
@@ -386,24 +458,140 @@ func (v *vcsCmd) run1(dir string, cmdline string, keyval []string, verbose bool)
 	out := buf.Bytes()
 	if err != nil {
 		if verbose || optVerbose {
+			stderrMu.Lock()
 			fmt.Fprintf(os.Stderr, "# cd %s; %s %s\n", dir, v.cmd, strings.Join(args, " "))
 			os.Stderr.Write(out)
+			stderrMu.Unlock()
 		}
 		return out, err
 	}
 	return out, nil
 }
 
+// skipCmd reports whether cmd should be skipped. Submodule commands
+// are only run with the vendor experiment enabled and never in offline
+// mode, since they may need to download the submodules.
+func skipCmd(cmd string) bool {
+	return strings.Contains(cmd, "submodule") && (!go15VendorExperiment || optOffline)
+}
+
 // ping pings to determine scheme to use.
 func (v *vcsCmd) ping(scheme, repo string) error {
+	if optOffline {
+		return errOffline
+	}
 	return v.runVerboseOnly(".", v.pingCmd, "scheme", scheme, "repo", repo)
 }
 
 // create creates a new copy of repo in dir.
 // The parent of dir must exist; dir must not.
+// If a mirror cache is in use and this VCS supports mirroring,
+// a local mirror of repo is created or refreshed first and
+// the copy is created from it. In offline mode the mirror
+// must already exist and it is not refreshed.
 func (v *vcsCmd) create(dir, repo string) error {
+	if optCacheDir == "" || v.mirrorCmd == nil {
+		if optOffline {
+			return errOffline
+		}
+		return v.createFrom(dir, repo)
+	}
+	mirror, err := v.mirror(repo)
+	if err != nil {
+		return err
+	}
+	if err := v.createFrom(dir, mirror); err != nil {
+		return err
+	}
+	return v.setRemote(v, dir, repo)
+}
+
+var mirrorGroup singleflight.Group
+
+// mirrorMarker is the file written into a mirror once it has been
+// completely created. A directory without it is left over from a
+// clone which was interrupted and is not used.
+const mirrorMarker = ".gofetch-mirror"
+
+// mirror creates or refreshes the local mirror of repo
+// in the cache and returns its path. The cache may be shared
+// with other processes, so the mirror is locked while it's
+// changed, and it is cloned beside its final location and
+// only moved into place once it's complete.
+func (v *vcsCmd) mirror(repo string) (string, error) {
+	dir := mirrorPath(optCacheDir, v, repo)
+	_, err, _ := mirrorGroup.Do(dir, func() (interface{}, error) {
+		if optOffline {
+			if !v.hasMirror(repo) {
+				return nil, errOffline
+			}
+			return nil, nil
+		}
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return nil, err
+		}
+		unlock, err := lockCachePath(dir)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		if isMirror(dir) {
+			for _, cmd := range v.mirrorSyncCmd {
+				if err := v.run(dir, cmd); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		}
+
+		// anything else there is incomplete
+		tmp := dir + ".tmp"
+		for _, p := range []string{dir, tmp} {
+			if err := os.RemoveAll(p); err != nil {
+				return nil, err
+			}
+		}
+		for _, cmd := range v.mirrorCmd {
+			if err := v.run(".", cmd, "dir", tmp, "repo", repo); err != nil {
+				os.RemoveAll(tmp)
+				return nil, err
+			}
+		}
+		if err := ioutil.WriteFile(filepath.Join(tmp, mirrorMarker), []byte(repo+"\n"), 0644); err != nil {
+			os.RemoveAll(tmp)
+			return nil, err
+		}
+		if err := os.Rename(tmp, dir); err != nil {
+			os.RemoveAll(tmp)
+			return nil, err
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not mirror %s: %v", repo, err)
+	}
+	return dir, nil
+}
+
+// isMirror reports whether dir is a complete mirror.
+func isMirror(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, mirrorMarker))
+	return err == nil
+}
+
+// hasMirror reports whether the cache contains a mirror of repo.
+func (v *vcsCmd) hasMirror(repo string) bool {
+	if optCacheDir == "" || v.mirrorCmd == nil {
+		return false
+	}
+	return isMirror(mirrorPath(optCacheDir, v, repo))
+}
+
+// createFrom creates a new copy of repo in dir.
+func (v *vcsCmd) createFrom(dir, repo string) error {
 	for _, cmd := range v.createCmd {
-		if !go15VendorExperiment && strings.Contains(cmd, "submodule") {
+		if skipCmd(cmd) {
 			continue
 		}
 		if err := v.run(".", cmd, "dir", dir, "repo", repo); err != nil {
@@ -415,11 +603,14 @@ func (v *vcsCmd) create(dir, repo string) error {
 
 // download downloads any new changes for the repo in dir.
 func (v *vcsCmd) download(dir string) error {
+	if optOffline {
+		return errOffline
+	}
 	if err := v.fixDetachedHead(dir); err != nil {
 		return err
 	}
 	for _, cmd := range v.downloadCmd {
-		if !go15VendorExperiment && strings.Contains(cmd, "submodule") {
+		if skipCmd(cmd) {
 			continue
 		}
 		if err := v.run(dir, cmd); err != nil {
@@ -469,6 +660,26 @@ func (v *vcsCmd) tags(dir string) ([]string, error) {
 	return tags, nil
 }
 
+// releaseTags returns the list of available tags for the repo in dir,
+// excluding any branches which tags would include.
+func (v *vcsCmd) releaseTags(dir string) ([]string, error) {
+	if v.releaseTagCmd == nil {
+		return v.tags(dir)
+	}
+	var tags []string
+	for _, tc := range v.releaseTagCmd {
+		out, err := v.runOutput(dir, tc.cmd)
+		if err != nil {
+			return nil, err
+		}
+		re := regexp.MustCompile(`(?m-s)` + tc.pattern)
+		for _, m := range re.FindAllStringSubmatch(string(out), -1) {
+			tags = append(tags, m[1])
+		}
+	}
+	return tags, nil
+}
+
 // tagSync syncs the repo in dir to the named tag,
 // which either is a tag returned by tags or is v.tagDefault.
 func (v *vcsCmd) tagSync(dir, tag string) error {
@@ -492,7 +703,7 @@ func (v *vcsCmd) tagSync(dir, tag string) error {
 
 	if tag == "" && v.tagSyncDefault != nil {
 		for _, cmd := range v.tagSyncDefault {
-			if !go15VendorExperiment && strings.Contains(cmd, "submodule") {
+			if skipCmd(cmd) {
 				continue
 			}
 			if err := v.run(dir, cmd); err != nil {
@@ -503,7 +714,7 @@ func (v *vcsCmd) tagSync(dir, tag string) error {
 	}
 
 	for _, cmd := range v.tagSyncCmd {
-		if !go15VendorExperiment && strings.Contains(cmd, "submodule") {
+		if skipCmd(cmd) {
 			continue
 		}
 		if err := v.run(dir, cmd, "tag", tag); err != nil {
@@ -513,6 +724,116 @@ func (v *vcsCmd) tagSync(dir, tag string) error {
 	return nil
 }
 
+// revision returns the current revision of the repo in dir.
+func (v *vcsCmd) revision(dir string) (string, error) {
+	out, err := v.runOutput(dir, v.revisionCmd.cmd)
+	if err != nil {
+		return "", err
+	}
+	re := regexp.MustCompile(`(?m-s)` + v.revisionCmd.pattern)
+	m := re.FindStringSubmatch(string(out))
+	if len(m) < 2 {
+		return "", fmt.Errorf("unable to parse output of %s %s", v.cmd, v.revisionCmd.cmd)
+	}
+	return m[1], nil
+}
+
+// revisionSync syncs the repo in dir to the named revision,
+// which is a revision previously returned by revision.
+func (v *vcsCmd) revisionSync(dir, rev string) error {
+	for _, cmd := range v.revisionSyncCmd {
+		if skipCmd(cmd) {
+			continue
+		}
+		if err := v.run(dir, cmd, "rev", rev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canResolve reports whether revisions can be resolved in a repo
+// without a working copy, such as a mirror.
+func (v *vcsCmd) canResolve() bool {
+	return v.revisionResolveCmd.cmd != ""
+}
+
+// resolveRevision returns the revision which rev, a tag, branch or
+// revision, refers to in the repo in dir, which need not have a
+// working copy. An empty rev refers to the default branch.
+func (v *vcsCmd) resolveRevision(dir, rev string) (string, error) {
+	if !v.canResolve() {
+		return "", fmt.Errorf("%s cannot resolve revisions without a working copy", v.name)
+	}
+	if rev == "" {
+		rev = v.revisionHead
+	}
+	out, err := v.runOutput(dir, v.revisionResolveCmd.cmd, "rev", rev)
+	if err != nil {
+		return "", err
+	}
+	re := regexp.MustCompile(`(?m-s)` + v.revisionResolveCmd.pattern)
+	m := re.FindStringSubmatch(string(out))
+	if len(m) < 2 {
+		return "", fmt.Errorf("unable to parse output of %s %s", v.cmd, v.revisionResolveCmd.cmd)
+	}
+	return m[1], nil
+}
+
+// revisionsSince returns the number of revisions between rev and
+// head in the repo in dir. Where revisions are numbered they are
+// simply compared; otherwise, if the VCS has no way to count them,
+// -1 is returned.
+func (v *vcsCmd) revisionsSince(dir, rev, head string) (int, error) {
+	if a, err := strconv.Atoi(rev); err == nil {
+		if b, err := strconv.Atoi(head); err == nil {
+			return b - a, nil
+		}
+	}
+	if v.revisionCountCmd == "" {
+		return -1, nil
+	}
+	out, err := v.runOutput(dir, v.revisionCountCmd, "rev", rev, "head", head)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+// revisionTags returns the tags at the named revision of the
+// repo in dir, or nil if the VCS has no way to list them.
+func (v *vcsCmd) revisionTags(dir, rev string) ([]string, error) {
+	if v.revisionTagsCmd.cmd == "" {
+		return nil, nil
+	}
+	out, err := v.runOutput(dir, v.revisionTagsCmd.cmd, "rev", rev)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	re := regexp.MustCompile(`(?m-s)` + v.revisionTagsCmd.pattern)
+	for _, m := range re.FindAllStringSubmatch(string(out), -1) {
+		tags = append(tags, m[1])
+	}
+	return tags, nil
+}
+
+// modified returns the files in the repo in dir which have
+// been modified, added or deleted locally, as reported by the VCS.
+func (v *vcsCmd) modified(dir string) ([]string, error) {
+	out, err := v.runOutput(dir, v.statusCmd)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
 // A vcsPath describes how to convert an import path into a
 // version control system and repository name.
 type vcsPath struct {
@@ -770,6 +1091,10 @@ func metaImportsForPrefix(importPrefix string, security securityMode) (urlStr st
 		}
 		fetchCacheMu.Unlock()
 
+		if urlStr, imports, ok := discovery.LookupImports(importPrefix); ok {
+			return setCache(fetchResult{urlStr: urlStr, imports: imports})
+		}
+
 		urlStr, body, err := httpsOrHTTP(importPrefix, security)
 		if err != nil {
 			return setCache(fetchResult{urlStr: urlStr, err: fmt.Errorf("fetch %s: %v", urlStr, err)})
@@ -780,6 +1105,8 @@ func metaImportsForPrefix(importPrefix string, security securityMode) (urlStr st
 		}
 		if len(imports) == 0 {
 			err = fmt.Errorf("fetch %s: no go-import meta tag", urlStr)
+		} else {
+			discovery.AddImports(importPrefix, urlStr, imports)
 		}
 		return setCache(fetchResult{urlStr: urlStr, imports: imports, err: err})
 	})
@@ -0,0 +1,155 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "os"
+  "fmt"
+  "path"
+  "text/tabwriter"
+)
+
+const (
+  verifyOK          = "ok"
+  verifyModified    = "modified"
+  verifyMissing     = "missing"
+  verifyUnverified  = "unverified"
+)
+
+/**
+ * The result of verifying a vendored repository
+ */
+type repoVerification struct {
+  Root      string  `json:"root"`
+  Output    string  `json:"output"`
+  Status    string  `json:"status"`
+  Expected  string  `json:"expected,omitempty"`  // the hash recorded in the lockfile
+  Actual    string  `json:"actual,omitempty"`    // the hash of the vendored tree
+}
+
+/**
+ * Verify that vendored repositories haven't been modified since they were
+ * fetched by comparing the hashes of their trees to those in the lockfile
+ */
+func verify(args []string) error {
+  
+  fOutput   := cmdline.String ("output",   os.Getenv("PWD"),  "The directory in which packages have been fetched.")
+  fLockfile := cmdline.String ("lockfile", defaultLockfile,   "The lockfile which records the fetched repositories, relative to the output directory.")
+  fAll      := cmdline.Bool   ("all",      false,             "List every repository, not only those which fail verification.")
+  cmdline.Parse(args)
+  
+  lockPath := lockfilePath(*fOutput, *fLockfile)
+  if lockPath == "" {
+    return usageError(fmt.Errorf("a lockfile is required to verify repositories"))
+  }
+  if _, err := os.Stat(lockPath); err != nil {
+    return fmt.Errorf("could not read lockfile: %v", err)
+  }
+  
+  lock, err := readLockfile(lockPath)
+  if err != nil {
+    return err
+  }
+  
+  var t *tabwriter.Writer
+  if !optJSON {
+    t = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+  }
+  
+  var failed, listed int
+  for _, e := range lock.Roots() {
+    res, err := verifyRepo(e, lock.Get(e), *fOutput)
+    if err != nil {
+      return err
+    }
+    
+    fail := res.Status == verifyModified || res.Status == verifyMissing
+    if fail {
+      failed++
+    }
+    
+    if optJSON {
+      if err := writeJSON(res); err != nil {
+        return err
+      }
+    }else if fail || *fAll || res.Status == verifyUnverified {
+      if listed == 0 {
+        fmt.Fprintf(t, "REPOSITORY\tSTATUS\n")
+      }
+      fmt.Fprintf(t, "%v\t%v\n", res.Root, res.Status)
+      listed++
+    }
+  }
+  
+  if t != nil {
+    err = t.Flush()
+    if err != nil {
+      return err
+    }
+  }
+  
+  if failed > 0 {
+    return fmt.Errorf("%d repository(s) failed verification", failed)
+  }
+  return nil
+}
+
+/**
+ * Verify a vendored repository against its lockfile entry. Repositories which
+ * were locked before hashes were recorded can't be verified.
+ */
+func verifyRepo(root string, entry lockEntry, outbase string) (*repoVerification, error) {
+  dir := path.Join(outbase, root)
+  res := &repoVerification{Root: root, Output: dir, Expected: entry.Hash}
+  
+  if !isDir(dir) {
+    res.Status = verifyMissing
+    return res, nil
+  }
+  if entry.Hash == "" {
+    res.Status = verifyUnverified
+    return res, nil
+  }
+  
+  var err error
+  res.Actual, err = treeHash(dir)
+  if err != nil {
+    return nil, err
+  }
+  
+  if res.Actual != res.Expected {
+    res.Status = verifyModified
+  }else{
+    res.Status = verifyOK
+  }
+  
+  return res, nil
+}
@@ -0,0 +1,174 @@
+// 
+// Go Fetch Dependencies
+// Copyright (c) 2015 Brian W. Wolter, All rights reserved.
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package main
+
+import (
+  "os"
+  "fmt"
+  "path"
+  "strings"
+)
+
+/**
+ * A link in an import chain: a package and the source file in that package
+ * which imports the next package in the chain. When the source is empty the
+ * next package is instead in the same repository, all of whose imports are
+ * followed unless individual packages are being followed.
+ */
+type importLink struct {
+  Package string
+  Source  string
+}
+
+/**
+ * Explain why a package was fetched
+ */
+func why(args []string) error {
+  
+  var fFrom stringList
+  fSource   := cmdline.String ("source",   os.Getenv("PWD"),  "The directory in which package sources are found.")
+  fLockfile := cmdline.String ("lockfile", defaultLockfile,   "The lockfile which records the requested packages, relative to the source directory.")
+  cmdline.Var (&fFrom, "from", "A package or path from which to search for imports (may be repeated). By default the packages requested when fetching are used.")
+  cmdline.Parse(args)
+  
+  if len(cmdline.Args()) != 1 {
+    return usageError(fmt.Errorf("usage: %v why [-options] package", cmd))
+  }
+  target := cmdline.Args()[0]
+  
+  build, err := parseBuildContext(optBuildOS, optBuildArch, optBuildTags)
+  if err != nil {
+    return usageError(err)
+  }
+  goVersion, err := parseGoVersion(optGoVersion)
+  if err != nil {
+    return usageError(err)
+  }
+  
+  opts := inferOptions{
+    ExcludeFilter: looksPrivateSourceFilter,
+    Build: build,
+    Packages: true,
+    GoVersion: goVersion,
+    Local: optLocalPackages,
+  }
+  
+  var lock *lockfile
+  if lockPath := lockfilePath(*fSource, *fLockfile); lockPath != "" {
+    lock, err = readLockfile(lockPath)
+    if err != nil {
+      return err
+    }
+  }
+  
+  roots := []string(fFrom)
+  if len(roots) < 1 && lock != nil {
+    roots = lock.RequestedPackages()
+  }
+  if len(roots) < 1 {
+    return usageError(fmt.Errorf("no packages to search from; provide them with -from"))
+  }
+  
+  // unless we're following individual packages, every package in a fetched
+  // repository contributes imports, which we need the lockfile to know about
+  var repos *lockfile
+  if !optPackageDeps {
+    repos = lock
+  }
+  
+  chain, err := importChain(roots, target, *fSource, repos, opts)
+  if err != nil {
+    return err
+  }
+  if chain == nil {
+    return fmt.Errorf("%v is not imported by %v", target, strings.Join(roots, ", "))
+  }
+  
+  fmt.Printf("%v\n", chain[0].Package)
+  for i := 1; i < len(chain); i++ {
+    if s := chain[i-1].Source; s != "" {
+      fmt.Printf("  imports %v (%v)\n", chain[i].Package, s)
+    }else{
+      fmt.Printf("  with %v (in the same repository)\n", chain[i].Package)
+    }
+  }
+  
+  return nil
+}
+
+/**
+ * Find the shortest import chain from any of the provided packages to the
+ * target package by following imports through the sources under the source
+ * directory. Roots may also be paths to directories which are not under the
+ * source directory. If repositories are provided, the packages in the same
+ * repository as a package are also followed. Nil is returned if the target is
+ * not reachable.
+ */
+func importChain(roots []string, target, srcbase string, repos *lockfile, opts inferOptions) ([]importLink, error) {
+  
+  type visit struct {
+    Parent, Source string
+  }
+  
+  visited := make(map[string]visit)
+  dir := func(pkg string) string { return path.Join(srcbase, pkg) }
+  
+  err := walkImports(roots, dir, repos, opts, func(pkg, parent, source string) bool {
+    visited[pkg] = visit{parent, source}
+    return pkg != target // the first chain found is among the shortest
+  })
+  if err != nil {
+    return nil, err
+  }
+  
+  v, ok := visited[target]
+  if !ok {
+    return nil, nil
+  }
+  
+  chain := []importLink{{Package: target}}
+  for v.Parent != "" {
+    chain = append([]importLink{{v.Parent, relativeSource(v.Source, srcbase)}}, chain...)
+    v = visited[v.Parent]
+  }
+  
+  return chain, nil
+}
+
+/**
+ * Express a source file path relative to the source directory, if it is under it
+ */
+func relativeSource(p, srcbase string) string {
+  if base := path.Clean(srcbase); strings.HasPrefix(p, base+"/") {
+    return p[len(base)+1:]
+  }
+  return p
+}